@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/yogischogi/phylofriend/genetic"
+	"github.com/yogischogi/phylofriend/genfiles"
+)
+
+// The functions in this file perform the single steps of an analysis.
+// They are shared by the commands and by the flag based form of the
+// program. Results are printed or written to files. If an error occurs
+// the program is terminated.
+
+// conversion contains the output filenames for persons' data.
+// Empty filenames are not written.
+type conversion struct {
+	txtout      string
+	csvout      string
+	htmlout     string
+	rdfout      string
+	popartout   string
+	traits      string
+	arpout      string
+	genalexout  string
+	populations string
+	// clusters are used as populations for "group" if they are
+	// not nil, see groupsOf.
+	clusters   []*genetic.Cluster
+	convert389 bool
+}
+
+// write writes the first nMarkers Y-STR values of persons into all
+// files of the conversion.
+func (c conversion) write(persons []*genetic.Person, nMarkers int, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) {
+	if c.txtout != "" {
+		err := writeOutput(c.txtout, func(w io.Writer) error {
+			return genfiles.WritePersonsAsTXTTo(w, persons, nMarkers)
+		})
+		exitOnError(err, "writing persons data to text file")
+	}
+	if c.csvout != "" {
+		exitOnError(genfiles.WritePersonsAsCSV(c.csvout, persons, nMarkers), "writing persons data to CSV file")
+	}
+	if c.htmlout != "" {
+		err := writeOutput(c.htmlout, func(w io.Writer) error {
+			return genfiles.WritePersonsAsHTMLTo(w, persons, nMarkers)
+		})
+		exitOnError(err, "writing persons data to HTML file")
+	}
+	if c.rdfout != "" {
+		exitOnError(genfiles.WriteRDF(c.rdfout, persons, nMarkers), "writing RDF file")
+	}
+	if c.popartout != "" {
+		traits := c.traits
+		if traits == "none" {
+			traits = ""
+		}
+		exitOnError(genfiles.WritePopART(c.popartout, persons, nMarkers, traits), "writing PopART file")
+	}
+	if c.arpout != "" || c.genalexout != "" {
+		groups := groupsOf(persons, c.clusters, c.populations, mutationRates, distanceModel)
+		if c.arpout != "" {
+			err := genfiles.WriteArlequin(c.arpout, groups, nMarkers, c.convert389)
+			exitOnError(err, "writing Arlequin file")
+		}
+		if c.genalexout != "" {
+			err := genfiles.WriteGenAlEx(c.genalexout, groups, nMarkers, c.convert389)
+			exitOnError(err, "writing GenAlEx file")
+		}
+	}
+}
+
+// selectStatistics returns the marker statistics of persons for the
+// markers selected by minFrequency, minValues and maxValues.
+// A maxValues <= 0 means no limit.
+func selectStatistics(persons []*genetic.Person, minFrequency float64, minValues, maxValues int) *genetic.MarkerStatistics {
+	if maxValues <= 0 {
+		maxValues = math.MaxInt32
+	}
+	return genetic.NewStatistics(persons).Select(minFrequency, minValues, maxValues)
+}
+
+// printPanel prints a panel of nMarkers markers chosen by the
+// criterion panelBy.
+func printPanel(persons []*genetic.Person, nMarkers int, panelBy string, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) {
+	criterion, err := genetic.NewPanelCriterion(panelBy)
+	exitOnError(err, "selecting panel")
+	steps := genetic.SelectPanel(persons, nMarkers, criterion, mutationRates, distanceModel)
+	fmt.Fprint(messages, genetic.PanelTable(steps))
+}
+
+// distances calculates the distance matrix and the number of
+// compared markers for persons in a single pass. Pairs of persons
+// who share less than minOverlap marker values are handled by mode:
+// "drop" removes persons until all remaining pairs share enough
+// values, "flag" prints a warning for each pair and marks it in the
+// distance matrix. The remaining persons are returned together with
+// both matrices.
+func distances(persons []*genetic.Person, minOverlap int, mode string, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) ([]*genetic.Person, *genetic.DistanceMatrix, *genetic.ComparedMatrix) {
+	dm, compared := genetic.NewDistanceMatrices(persons, mutationRates, distanceModel)
+	if minOverlap <= 0 {
+		return persons, dm, compared
+	}
+	switch mode {
+	case "drop":
+		reduced, err := genetic.ReduceToOverlap(persons, compared, minOverlap)
+		exitOnError(err, "reducing persons for the minimum overlap")
+		// Keep the rows of the remaining persons.
+		index := make(map[*genetic.Person]int)
+		for i, person := range persons {
+			index[person] = i
+		}
+		indices := make([]int, len(reduced))
+		for i, person := range reduced {
+			indices[i] = index[person]
+		}
+		return reduced, dm.Select(indices), compared.Select(indices)
+	case "flag":
+		pairs := compared.Below(minOverlap)
+		for _, pair := range pairs {
+			fmt.Fprintf(messages, "Warning, %s and %s share only %d markers.\n",
+				persons[pair[0]].Label, persons[pair[1]].Label, compared.Values[pair[0]][pair[1]])
+		}
+		dm.Flag(pairs)
+		return persons, dm, compared
+	default:
+		fmt.Fprintf(messages, "Error, unknown overlap mode: %s.\n", mode)
+		os.Exit(1)
+	}
+	return nil, nil, nil
+}
+
+// comparePersons prints a comparison of two persons marker by marker.
+// names contains the names of both persons separated by a comma.
+func comparePersons(persons []*genetic.Person, names string, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) {
+	pair := strings.Split(names, ",")
+	if len(pair) != 2 {
+		fmt.Fprintf(messages, "Error, compare needs exactly two persons.\n")
+		os.Exit(1)
+	}
+	person1, err := findPerson(persons, pair[0])
+	exitOnError(err, "comparing persons")
+	person2, err := findPerson(persons, pair[1])
+	exitOnError(err, "comparing persons")
+	fmt.Fprint(messages, genetic.NewComparison(person1, person2, mutationRates, distanceModel).String())
+}
+
+// findPerson returns the first person whose ID, name or label
+// matches name. Leading underscores of labels are ignored.
+func findPerson(persons []*genetic.Person, name string) (*genetic.Person, error) {
+	name = strings.TrimSpace(name)
+	for _, person := range persons {
+		if person.ID == name ||
+			person.Name == name ||
+			person.Label == name ||
+			strings.TrimLeft(person.Label, "_") == name {
+			return person, nil
+		}
+	}
+	return nil, fmt.Errorf("person %s not found", name)
+}
+
+// writeDistances writes the distance matrix dm in PHYLIP and NEXUS
+// format and the number of compared markers for persons.
+// tree is written into the NEXUS file if it is not nil.
+func writeDistances(persons []*genetic.Person, dm *genetic.DistanceMatrix, compared *genetic.ComparedMatrix, tree *genetic.Node, phylipout, nexusout, comparedout string) {
+	if phylipout != "" {
+		err := writeOutput(phylipout, func(w io.Writer) error {
+			return genfiles.WriteDistanceMatrixTo(w, persons, dm)
+		})
+		exitOnError(err, "writing PHYLIP file")
+	}
+	if nexusout != "" {
+		exitOnError(genfiles.WriteNexus(nexusout, persons, dm, tree), "writing NEXUS file")
+	}
+	if comparedout != "" {
+		exitOnError(genfiles.WriteComparedMatrix(comparedout, persons, compared), "writing compared markers")
+	}
+}
+
+// printModalDistance prints the average distance of persons from
+// their modal haplotype. dm must contain the modal haplotype in the
+// first row.
+func printModalDistance(dm *genetic.DistanceMatrix) {
+	// The first entry is the distance of the modal haplotype to itself.
+	m, s, err := genetic.Average(dm.Values[0][1:dm.Size])
+	exitOnError(err, "calculating average and standard deviation")
+	fmt.Fprintf(messages, "Average distance from modal haplotype: %.2f ± %.2f\n", m, s)
+	fmt.Fprintf(messages, "No correction for Poisson distribution and back mutations.\n")
+}
+
+// detectClusters detects clusters of persons by the given method,
+// hierarchical or density, and prints them.
+func detectClusters(persons []*genetic.Person, method string, cutoff float64, minPoints int, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) []*genetic.Cluster {
+	var clusters []*genetic.Cluster
+	dm := genetic.NewDistanceMatrix(persons, mutationRates, distanceModel.Distance)
+	switch method {
+	case "hierarchical":
+		clusters = genetic.HierarchicalClusters(persons, dm, cutoff, mutationRates, distanceModel)
+	case "density":
+		clusters = genetic.DensityClusters(persons, dm, cutoff, minPoints, mutationRates, distanceModel)
+	default:
+		fmt.Fprintf(messages, "Error, unknown clustering method: %s.\n", method)
+		os.Exit(1)
+	}
+	for _, c := range clusters {
+		fmt.Fprint(messages, c.String())
+	}
+	return clusters
+}
+
+// writeClusters writes persons and their cluster names in CSV format.
+func writeClusters(filename string, persons []*genetic.Person, clusters []*genetic.Cluster, nMarkers int) {
+	// Store the cluster names in a copy of the persons.
+	clustered := make([]*genetic.Person, len(persons))
+	for _, c := range clusters {
+		for i, member := range c.Members {
+			person := *c.Persons[i]
+			person.Group = c.Name
+			clustered[member] = &person
+		}
+	}
+	exitOnError(genfiles.WritePersonsAsCSV(filename, clustered, nMarkers), "writing clusters to CSV file")
+}
+
+// groupsOf returns the populations of persons, grouped by "group"
+// or by "origin". If clusters have been detected, they are used
+// as groups.
+func groupsOf(persons []*genetic.Person, clusters []*genetic.Cluster, populations string, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) []*genetic.Cluster {
+	switch populations {
+	case "group":
+		if clusters != nil {
+			return clusters
+		}
+		return genetic.ClustersByGroup(persons, mutationRates, distanceModel)
+	case "origin":
+		return genetic.ClustersByOrigin(persons, mutationRates, distanceModel)
+	default:
+		fmt.Fprintf(messages, "Error, unknown populations: %s.\n", populations)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// printSignatures prints the signature marker values of groups.
+func printSignatures(groups []*genetic.Cluster, minInGroup, maxOutside float64) {
+	for _, signature := range genetic.Signatures(groups, minInGroup, maxOutside) {
+		fmt.Fprint(messages, signature.String())
+	}
+}
+
+// writeGroupModals prints a summary for each group and writes the
+// modal haplotypes of all groups in CSV or text format.
+func writeGroupModals(filename string, groups []*genetic.Cluster, nMarkers int, generationDistance, calibrationFactor float64) {
+	fmt.Fprint(messages, genetic.ClustersTable(groups, generationDistance, calibrationFactor))
+	fmt.Fprintf(messages, "No correction for Poisson distribution and back mutations.\n")
+	if filename == "" {
+		return
+	}
+	modals := make([]*genetic.Person, len(groups))
+	for i, group := range groups {
+		modal := *group.Modal
+		modal.ID = group.Name
+		modal.Name = group.Name
+		modal.Group = group.Name
+		modal.Label = genfiles.StringToLabel(group.Name)
+		modals[i] = &modal
+	}
+	var err error
+	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		err = genfiles.WritePersonsAsCSV(filename, modals, nMarkers)
+	} else {
+		err = writeOutput(filename, func(w io.Writer) error {
+			return genfiles.WritePersonsAsTXTTo(w, modals, nMarkers)
+		})
+	}
+	exitOnError(err, "writing modal haplotypes of groups")
+}
+
+// printOutliers prints the members of groups whose distance exceeds
+// the group's mean by more than threshold standard deviations.
+func printOutliers(groups []*genetic.Cluster, threshold float64, mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) {
+	for _, outlier := range genetic.Outliers(groups, mutationRates, distanceModel.Distance, threshold) {
+		fmt.Fprintln(messages, outlier.String())
+	}
+}
+
+// writeDiversity writes the diversity of all persons and of each group.
+func writeDiversity(filename string, persons []*genetic.Person, groups []*genetic.Cluster) {
+	names := []string{"all"}
+	statistics := []*genetic.MarkerStatistics{genetic.NewStatistics(persons)}
+	// Persons without groups result in a single noise cluster.
+	if len(groups) > 1 || (len(groups) == 1 && groups[0].Name != "noise") {
+		for _, group := range groups {
+			names = append(names, group.Name)
+			statistics = append(statistics, genetic.NewStatistics(group.Persons))
+		}
+	}
+	exitOnError(genfiles.WriteDiversity(filename, names, statistics), "writing diversity")
+}
+
+// printPopulationStatistics prints Fst, Rst and an AMOVA for groups.
+func printPopulationStatistics(groups []*genetic.Cluster, nPermutations int, policy genetic.MicroallelePolicy) {
+	statistics, err := genetic.NewPopulationStatistics(groups, nPermutations, policy)
+	exitOnError(err, "calculating population statistics")
+	fmt.Fprint(messages, statistics.String())
+}
+
+// readTree reads a tree in Newick format and maps its labels to persons.
+func readTree(filename string, persons []*genetic.Person) *genetic.Node {
+	tree, err := genfiles.ReadNewickTree(filename)
+	exitOnError(err, "reading tree")
+	tree.NameInternalNodes()
+	for _, label := range genfiles.MapLabels(tree, persons) {
+		fmt.Fprintf(messages, "Warning, no person found for label %s.\n", label)
+	}
+	return tree
+}
+
+// printAncestors reconstructs the ancestral haplotypes of a tree and
+// prints the mutations on each branch.
+func printAncestors(tree *genetic.Node, policy genetic.MicroallelePolicy) {
+	genetic.ReconstructAncestors(tree, policy)
+	fmt.Fprint(messages, genetic.MutationsReport(tree))
+}
+
+// buildNetwork calculates a haplotype network by the given method,
+// mj or msn, and writes it to networkout and networksvg.
+func buildNetwork(persons []*genetic.Person, method, networkout, networksvg string, policy genetic.MicroallelePolicy) {
+	var network *genetic.Network
+	switch method {
+	case "mj":
+		network = genetic.MedianJoiningNetwork(persons, policy)
+	case "msn":
+		network = genetic.MinimumSpanningNetwork(persons, policy)
+	default:
+		fmt.Fprintf(messages, "Error, unknown network method: %s.\n", method)
+		os.Exit(1)
+	}
+	fmt.Fprintf(messages, "Network of %d vertices and %d edges using %d markers.\n",
+		len(network.Vertices), len(network.Edges), len(network.Markers))
+	if networkout != "" {
+		var err error
+		if strings.HasSuffix(strings.ToLower(networkout), ".graphml") {
+			err = genfiles.WriteNetworkGraphML(networkout, network)
+		} else {
+			err = genfiles.WriteNetworkJSON(networkout, network)
+		}
+		exitOnError(err, "writing network")
+	}
+	if networksvg != "" {
+		exitOnError(genfiles.WriteNetworkSVG(networksvg, network), "writing network image")
+	}
+}
+
+// trainHaplogroupModel trains a haplogroup model with the groups of
+// persons and writes it to a file.
+func trainHaplogroupModel(filename string, persons []*genetic.Person, smoothing float64) {
+	model := genetic.TrainHaplogroupModel(persons, smoothing)
+	exitOnError(genfiles.WriteHaplogroupModel(filename, model), "writing haplogroup model")
+}
+
+// predictHaplogroups prints the n most likely haplogroups of each
+// person using the model in the file hgmodel.
+func predictHaplogroups(hgmodel string, persons []*genetic.Person, n int) {
+	if hgmodel == "" {
+		fmt.Fprintf(messages, "Error, haplogroup prediction needs a model (-hgmodel).\n")
+		os.Exit(1)
+	}
+	model, err := genfiles.ReadHaplogroupModel(hgmodel)
+	exitOnError(err, "reading haplogroup model")
+	for _, person := range persons {
+		predictions := model.Predict(person.YstrMarkers)
+		if len(predictions) > n {
+			predictions = predictions[:n]
+		}
+		fmt.Fprint(messages, person.Label+":")
+		for _, p := range predictions {
+			fmt.Fprintf(messages, " %s %.1f%%", p.Haplogroup, 100*p.Probability)
+		}
+		fmt.Fprint(messages, "\n")
+	}
+}
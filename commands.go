@@ -0,0 +1,443 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yogischogi/phylofriend/genetic"
+	"github.com/yogischogi/phylofriend/genfiles"
+)
+
+// command is a subcommand of the program, for example
+// "phylofriend distance -personsin persons.csv -phylipout dm.txt".
+type command struct {
+	name        string
+	description string
+	run         func(args []string)
+}
+
+// commands returns all subcommands.
+func commands() []command {
+	return []command{
+		{"convert", "Converts persons' Y-STR values into other file formats.", runConvert},
+		{"distance", "Calculates genetic distances and compares persons.", runDistance},
+		{"tree", "Calculates trees, ancestral haplotypes and haplotype networks.", runTree},
+		{"stats", "Prints and writes marker, group and population statistics.", runStats},
+		{"match", "Finds the closest matches and predicts haplogroups.", runMatch},
+		{"modal", "Calculates modal haplotypes and their age.", runModal},
+		{"rates", "Writes mutation rates.", runRates},
+	}
+}
+
+func main() {
+	// Without a command the program is controlled by flags only,
+	// as in former versions.
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		runFlags()
+		return
+	}
+	name := os.Args[1]
+	for _, c := range commands() {
+		if c.name == name {
+			c.run(os.Args[2:])
+			return
+		}
+	}
+	if name != "help" {
+		fmt.Fprintf(messages, "Error, unknown command: %s.\n", name)
+	}
+	printCommands()
+	if name != "help" {
+		os.Exit(1)
+	}
+}
+
+// printCommands prints a list of all commands.
+func printCommands() {
+	fmt.Printf("Usage: phylofriend <command> [flags]\n\nCommands:\n")
+	for _, c := range commands() {
+		fmt.Printf("  %-10s %s\n", c.name, c.description)
+	}
+	fmt.Printf("\nUse \"phylofriend <command> -help\" for the flags of a command.\n")
+	fmt.Printf("Without a command all flags of former versions are supported.\n")
+}
+
+// newFlagSet creates the flag set for a command with a usage message.
+func newFlagSet(name, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: phylofriend %s [flags]\n%s\n\nFlags:\n", name, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// messages receives all reports, warnings and errors. It is standard
+// error if an output is written to standard output, see setMessages.
+var messages io.Writer = os.Stdout
+
+// exitOnError prints an error message and exits the program
+// if err is not nil. context describes what went wrong.
+func exitOnError(err error, context string) {
+	if err != nil {
+		fmt.Fprintf(messages, "Error %s, %v.\n", context, err)
+		os.Exit(1)
+	}
+}
+
+// writeOutput calls write for the file filename. If filename is "-"
+// write is called for standard output.
+func writeOutput(filename string, write func(w io.Writer) error) error {
+	if filename == "-" {
+		return write(os.Stdout)
+	}
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	return write(outfile)
+}
+
+// setup parses the arguments of a command and reads the persons,
+// the mutation rates and the distance model given by the input flags.
+func setup(fs *flag.FlagSet, in *inputFlags, args []string) ([]*genetic.Person, genetic.YstrMarkers, genetic.DistanceModel) {
+	exitOnError(in.parse(fs, args), "parsing flags")
+	distanceModel, err := in.distanceModel()
+	exitOnError(err, "in distance model")
+	mutationRates, err := in.mutationRates()
+	exitOnError(err, "reading mutation rates")
+	persons, err := in.readPersons(mutationRates, distanceModel)
+	exitOnError(err, "reading persons")
+	return persons, mutationRates, distanceModel
+}
+
+// runConvert converts persons' Y-STR values into other file formats.
+func runConvert(args []string) {
+	fs := newFlagSet("convert", "Converts persons' Y-STR values into other file formats.")
+	in := addInputFlags(fs)
+	var (
+		txtout      = fs.String("txtout", "", "Output filename for persons in text format.")
+		csvout      = fs.String("csvout", "", "Output filename for persons in CSV format.")
+		htmlout     = fs.String("htmlout", "", "Output filename for persons in HTML format.")
+		rdfout      = fs.String("rdfout", "", "Output filename for persons in RDF format for Network.")
+		popartout   = fs.String("popartout", "", "Output filename for persons in NEXUS format for PopART.")
+		traits      = fs.String("traits", "group", "Traits for PopART output: group, origin or none.")
+		arpout      = fs.String("arpout", "", "Output filename for persons in Arlequin project format.")
+		genalexout  = fs.String("genalexout", "", "Output filename for persons in GenAlEx layout (CSV).")
+		populations = fs.String("populations", "origin", "Grouping of persons into populations: origin or group.")
+		convert389  = fs.Bool("convert389", false, "Replaces DYS389ii by DYS389ii-i in population data.")
+	)
+	persons, mutationRates, distanceModel := setup(fs, in, args)
+	conversion{
+		txtout:      *txtout,
+		csvout:      *csvout,
+		htmlout:     *htmlout,
+		rdfout:      *rdfout,
+		popartout:   *popartout,
+		traits:      *traits,
+		arpout:      *arpout,
+		genalexout:  *genalexout,
+		populations: *populations,
+		convert389:  *convert389,
+	}.write(persons, in.nMarkers(), mutationRates, distanceModel)
+}
+
+// runDistance calculates genetic distances and compares persons.
+func runDistance(args []string) {
+	fs := newFlagSet("distance", "Calculates genetic distances and compares persons.")
+	in := addInputFlags(fs)
+	var (
+		phylipout   = fs.String("phylipout", "", "Output filename for PHYLIP distance matrix.")
+		nexusout    = fs.String("nexusout", "", "Output filename for NEXUS distance matrix.")
+		comparedout = fs.String("comparedout", "", "Output filename for the number of compared markers per pair.")
+		minoverlap  = fs.Int("minoverlap", 0, "Minimum number of compared markers per pair.")
+		overlapmode = fs.String("overlapmode", "flag", "Handling of pairs below minoverlap: flag or drop.")
+		compare     = fs.String("compare", "", "Compares two persons marker by marker, for example A,B.")
+		cal         = fs.Float64("cal", 1, "Calibration factor for PHYLIP output.")
+		gentime     = fs.Float64("gentime", 1, "Generation time in years.")
+	)
+	persons, mutationRates, distanceModel := setup(fs, in, args)
+	var dm *genetic.DistanceMatrix
+	var compared *genetic.ComparedMatrix
+	if *minoverlap > 0 || *phylipout != "" || *nexusout != "" || *comparedout != "" {
+		persons, dm, compared = distances(persons, *minoverlap, *overlapmode, mutationRates, distanceModel)
+	}
+	if *compare != "" {
+		comparePersons(persons, *compare, mutationRates, distanceModel)
+	}
+	if *phylipout != "" || *nexusout != "" || *comparedout != "" {
+		dm = dm.Years(*gentime, *cal)
+		writeDistances(persons, dm, compared, nil, *phylipout, *nexusout, *comparedout)
+	}
+}
+
+// runTree calculates trees, ancestral haplotypes and haplotype networks.
+func runTree(args []string) {
+	fs := newFlagSet("tree", "Calculates trees, ancestral haplotypes and haplotype networks.\n"+
+		"If no tree is given by -treein, a UPGMA tree is calculated.")
+	in := addInputFlags(fs)
+	var (
+		treein     = fs.String("treein", "", "Input filename for a tree in Newick format.")
+		treeout    = fs.String("treeout", "", "Output filename for the tree in Newick format.")
+		nexusout   = fs.String("nexusout", "", "Output filename for the distance matrix and the tree in NEXUS format.")
+		ancestors  = fs.Bool("ancestors", false, "Reconstructs ancestral haplotypes and prints the mutations on each branch of the tree.")
+		network    = fs.String("network", "", "Calculates a haplotype network: mj (median-joining) or msn (minimum spanning).")
+		networkout = fs.String("networkout", "", "Output filename (.json or .graphml) for the haplotype network.")
+		networksvg = fs.String("networksvg", "", "Output filename for an SVG image of the haplotype network.")
+		cal        = fs.Float64("cal", 1, "Calibration factor for distances.")
+		gentime    = fs.Float64("gentime", 1, "Generation time in years.")
+	)
+	persons, mutationRates, distanceModel := setup(fs, in, args)
+	if len(persons) == 0 {
+		fmt.Fprintf(messages, "Error, no persons.\n")
+		os.Exit(1)
+	}
+
+	// The tree is built from the genetic distances. Years are
+	// only used for output, because they are whole numbers.
+	dm := genetic.NewDistanceMatrix(persons, mutationRates, distanceModel.Distance)
+	var tree *genetic.Node
+	if *treein != "" {
+		tree = readTree(*treein, persons)
+	} else {
+		tree = genetic.NewUPGMATree(persons, dm)
+	}
+	if *ancestors == true {
+		printAncestors(tree, distanceModel.Microalleles)
+	}
+	if *treeout != "" {
+		exitOnError(genfiles.WriteNewickTree(*treeout, tree), "writing tree")
+	}
+	writeDistances(persons, dm.Years(*gentime, *cal), nil, tree, "", *nexusout, "")
+	if *network != "" {
+		buildNetwork(persons, *network, *networkout, *networksvg, distanceModel.Microalleles)
+	}
+}
+
+// runStats prints and writes marker, group and population statistics.
+func runStats(args []string) {
+	fs := newFlagSet("stats", "Prints and writes marker, group and population statistics.\n"+
+		"Groups are read by -groupcol or detected by -cluster.\n"+
+		"Without other output flags the marker statistics are printed.")
+	in := addInputFlags(fs)
+	var (
+		statsout     = fs.String("statsout", "", "Output filename (.csv or .json) for marker statistics.")
+		minfreq      = fs.Float64("minfreq", 0, "Minimum share of persons who have tested for a marker in statistics.")
+		minvalues    = fs.Int("minvalues", 1, "Minimum number of different values of a marker in statistics.")
+		maxvalues    = fs.Int("maxvalues", 0, "Maximum number of different values of a marker in statistics (0 for no limit).")
+		diversity    = fs.String("diversity", "", "Output filename (.csv or .json) for the diversity of markers and groups.")
+		rankmarkers  = fs.Bool("rankmarkers", false, "Prints all markers ranked by information content.")
+		panel        = fs.Int("panel", 0, "Selects a panel of the given number of markers that best resolves the persons.")
+		panelby      = fs.String("panelby", "haplotypes", "Criterion for marker panels: haplotypes or tree.")
+		cluster      = fs.String("cluster", "", "Detects clusters of persons: hierarchical or density.")
+		cutoff       = fs.Float64("cutoff", 1, "Maximum distance within clusters.")
+		minpoints    = fs.Int("minpoints", 3, "Minimum number of neighbours for density clustering.")
+		clusterout   = fs.String("clusterout", "", "Output filename for persons with cluster names in CSV format.")
+		signatures   = fs.Bool("signatures", false, "Prints signature marker values for each group or cluster.")
+		signaturemin = fs.Float64("signaturemin", 0.9, "Minimum frequency of a signature value inside a group.")
+		signaturemax = fs.Float64("signaturemax", 0.1, "Maximum frequency of a signature value outside a group.")
+		groupmodals  = fs.String("groupmodals", "", "Output filename (.txt or .csv) for the modal haplotypes of all groups.")
+		outliers     = fs.Float64("outliers", 0, "Prints group members whose distance exceeds the group's mean by the given number of standard deviations.")
+		popstats     = fs.Bool("popstats", false, "Prints Fst, Rst and an AMOVA for the populations given by -populations.")
+		permutations = fs.Int("permutations", 1000, "Number of permutations for the p-values of population statistics.")
+		populations  = fs.String("populations", "origin", "Grouping of persons into populations: origin or group.")
+		cal          = fs.Float64("cal", 1, "Calibration factor for the age of groups.")
+		gentime      = fs.Float64("gentime", 1, "Generation time in years.")
+	)
+	persons, mutationRates, distanceModel := setup(fs, in, args)
+	n := in.nMarkers()
+
+	stats := selectStatistics(persons, *minfreq, *minvalues, *maxvalues)
+	isPrinted := false
+	if *statsout != "" {
+		exitOnError(genfiles.WriteStatistics(*statsout, stats), "writing statistics")
+		isPrinted = true
+	}
+	if *rankmarkers == true {
+		fmt.Fprint(messages, genetic.MarkerRanksTable(genetic.RankMarkers(persons)))
+		isPrinted = true
+	}
+	if *panel > 0 {
+		printPanel(persons, *panel, *panelby, mutationRates, distanceModel)
+		isPrinted = true
+	}
+
+	var clusters []*genetic.Cluster
+	if *cluster != "" {
+		clusters = detectClusters(persons, *cluster, *cutoff, *minpoints, mutationRates, distanceModel)
+		if *clusterout != "" {
+			writeClusters(*clusterout, persons, clusters, n)
+		}
+		isPrinted = true
+	}
+	if *signatures == true || *groupmodals != "" || *outliers > 0 || *diversity != "" {
+		groups := groupsOf(persons, clusters, "group", mutationRates, distanceModel)
+		if *signatures == true {
+			printSignatures(groups, *signaturemin, *signaturemax)
+		}
+		if *groupmodals != "" {
+			writeGroupModals(*groupmodals, groups, n, *gentime, *cal)
+		}
+		if *outliers > 0 {
+			printOutliers(groups, *outliers, mutationRates, distanceModel)
+		}
+		if *diversity != "" {
+			writeDiversity(*diversity, persons, groups)
+		}
+		isPrinted = true
+	}
+	if *popstats == true {
+		groups := groupsOf(persons, clusters, *populations, mutationRates, distanceModel)
+		printPopulationStatistics(groups, *permutations, distanceModel.Microalleles)
+		isPrinted = true
+	}
+	if !isPrinted {
+		fmt.Fprint(messages, stats.String())
+	}
+}
+
+// runMatch finds the closest matches and haplogroups of a person
+// and trains haplogroup models.
+func runMatch(args []string) {
+	fs := newFlagSet("match", "Finds the closest matches and haplogroups of a person.\n"+
+		"Without -person the haplogroups of all persons are predicted by -hgmodel.\n"+
+		"Haplogroup models are trained with the groups of persons (-groupcol).")
+	in := addInputFlags(fs)
+	var (
+		person    = fs.String("person", "", "ID, name or label of the person.")
+		n         = fs.Int("n", 10, "Number of matches and haplogroups.")
+		compare   = fs.Bool("compare", false, "Compares the person marker by marker with each match.")
+		hgmodel   = fs.String("hgmodel", "", "Filename of the reference model for haplogroup prediction.")
+		train     = fs.String("train", "", "Output filename for a haplogroup model trained with the groups of persons.")
+		smoothing = fs.Float64("smoothing", 1, "Smoothing of allele counts for haplogroup models.")
+		folds     = fs.Int("folds", 0, "Number of folds for the cross validation of haplogroup models.")
+		cal       = fs.Float64("cal", 1, "Calibration factor for distances.")
+		gentime   = fs.Float64("gentime", 1, "Generation time in years.")
+	)
+	persons, mutationRates, distanceModel := setup(fs, in, args)
+	if *person == "" && *hgmodel == "" && *train == "" && *folds <= 1 {
+		fmt.Fprintf(messages, "Error, match needs a person (-person), a model (-hgmodel), -train or -folds.\n")
+		os.Exit(1)
+	}
+	if *train != "" {
+		trainHaplogroupModel(*train, persons, *smoothing)
+	}
+	if *folds > 1 {
+		fmt.Fprint(messages, genetic.CrossValidate(persons, *folds, *smoothing).String())
+	}
+	if *person == "" {
+		if *hgmodel != "" {
+			predictHaplogroups(*hgmodel, persons, *n)
+		}
+		return
+	}
+	p, err := findPerson(persons, *person)
+	exitOnError(err, "finding person")
+
+	// Sort all other persons by distance.
+	type match struct {
+		person    *genetic.Person
+		distance  float64
+		nCompared int
+	}
+	matches := make([]match, 0, len(persons))
+	for _, other := range persons {
+		if other == p {
+			continue
+		}
+		d := distanceModel.Distance(p.YstrMarkers, other.YstrMarkers, mutationRates)
+		if math.IsNaN(d) || math.IsInf(d, 0) {
+			continue
+		}
+		nCompared := distanceModel.NCompared(p.YstrMarkers, other.YstrMarkers, mutationRates)
+		matches = append(matches, match{other, math.Trunc(d * *gentime * *cal), nCompared})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+	if len(matches) > *n {
+		matches = matches[:*n]
+	}
+	fmt.Fprintf(messages, "Closest matches of %s:\n", p.Label)
+	fmt.Fprintf(messages, "%-12s %10s %10s\n", "Label", "Distance", "Compared")
+	for _, m := range matches {
+		fmt.Fprintf(messages, "%-12s %10g %10d\n", m.person.Label, m.distance, m.nCompared)
+	}
+	if *compare == true {
+		for _, m := range matches {
+			fmt.Fprintln(messages)
+			fmt.Fprint(messages, genetic.NewComparison(p, m.person, mutationRates, distanceModel).String())
+		}
+	}
+	if *hgmodel != "" {
+		fmt.Fprintf(messages, "\nMost likely haplogroups:\n")
+		predictHaplogroups(*hgmodel, []*genetic.Person{p}, *n)
+	}
+}
+
+// runModal calculates modal haplotypes and their age.
+func runModal(args []string) {
+	fs := newFlagSet("modal", "Calculates modal haplotypes and their age.")
+	in := addInputFlags(fs)
+	var (
+		out     = fs.String("out", "", "Output filename (.txt or .csv) for the modal haplotypes.")
+		bygroup = fs.Bool("bygroup", false, "Calculates the modal haplotype of each group.")
+		cal     = fs.Float64("cal", 1, "Calibration factor for distances.")
+		gentime = fs.Float64("gentime", 1, "Generation time in years.")
+	)
+	persons, mutationRates, distanceModel := setup(fs, in, args)
+	if *bygroup == true {
+		groups := genetic.ClustersByGroup(persons, mutationRates, distanceModel)
+		writeGroupModals(*out, groups, in.nMarkers(), *gentime, *cal)
+		return
+	}
+	modal := genetic.ModalHaplotypeWith(persons, distanceModel.Microalleles)
+	dm := genetic.NewDistanceMatrix(append([]*genetic.Person{modal}, persons...), mutationRates, distanceModel.Distance)
+	printModalDistance(dm.Years(*gentime, *cal))
+	if *out != "" {
+		var err error
+		if strings.HasSuffix(strings.ToLower(*out), ".csv") {
+			err = genfiles.WritePersonsAsCSV(*out, []*genetic.Person{modal}, in.nMarkers())
+		} else {
+			err = writeOutput(*out, func(w io.Writer) error {
+				return genfiles.WritePersonsAsTXTTo(w, []*genetic.Person{modal}, in.nMarkers())
+			})
+		}
+		exitOnError(err, "writing modal haplotype")
+	}
+}
+
+// runRates writes mutation rates.
+func runRates(args []string) {
+	fs := newFlagSet("rates", "Writes mutation rates. The rates are read by -mrin or the default rates are used.\n"+
+		"If persons are given, counting rates for the markers selected by\n"+
+		"-minfreq, -minvalues and -maxvalues can be written.")
+	in := addInputFlags(fs)
+	var (
+		mrout      = fs.String("mrout", "", "Output filename for the mutation rates.")
+		countmrout = fs.String("countmrout", "", "Output filename for counting mutation rates of the selected markers.")
+		minfreq    = fs.Float64("minfreq", 0, "Minimum share of persons who have tested for a marker.")
+		minvalues  = fs.Int("minvalues", 1, "Minimum number of different values of a marker.")
+		maxvalues  = fs.Int("maxvalues", 0, "Maximum number of different values of a marker (0 for no limit).")
+	)
+	exitOnError(in.parse(fs, args), "parsing flags")
+	mutationRates, err := in.mutationRates()
+	exitOnError(err, "reading mutation rates")
+	if *mrout != "" {
+		exitOnError(genfiles.WriteMutationRates(*mrout, mutationRates), "writing mutation rates")
+	}
+	if *countmrout != "" {
+		distanceModel, err := in.distanceModel()
+		exitOnError(err, "in distance model")
+		persons, err := in.readPersons(mutationRates, distanceModel)
+		exitOnError(err, "reading persons")
+		stats := selectStatistics(persons, *minfreq, *minvalues, *maxvalues)
+		exitOnError(genfiles.WriteCountingRates(*countmrout, stats), "writing counting mutation rates")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFilename is the name of the file that contains the effective
+// configuration of a run. It is written to the output directory.
+const configFilename = "phylofriend-config.json"
+
+// readConfig reads a configuration file in JSON format and sets all
+// flags that are not set on the command line. The file contains an
+// object with flag names as keys, for example
+//
+//	{"personsin": ["a.csv", "b.csv"], "labelcol": 2, "gentime": 30}
+//
+// Lists are joined by commas. Options that are not defined for the
+// flag set, for example options of other commands, are not used.
+// Their names are returned in alphabetical order.
+func readConfig(filename string, fs *flag.FlagSet) (unused []string, err error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags given on the command line override the file.
+	isSet := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		isSet[f.Name] = true
+	})
+	for name, value := range config {
+		if name == "config" {
+			return nil, errors.New("config files can not be nested")
+		}
+		if fs.Lookup(name) == nil {
+			unused = append(unused, name)
+			continue
+		}
+		if isSet[name] {
+			continue
+		}
+		text, err := configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("option %s, %v", name, err)
+		}
+		err = fs.Set(name, text)
+		if err != nil {
+			return nil, fmt.Errorf("option %s, %v", name, err)
+		}
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
+
+// configValue converts a value of a JSON configuration file into
+// the text form of a flag value.
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		texts := make([]string, len(v))
+		for i, element := range v {
+			text, err := configValue(element)
+			if err != nil {
+				return "", err
+			}
+			texts[i] = text
+		}
+		return strings.Join(texts, ","), nil
+	default:
+		return "", errors.New("unsupported value")
+	}
+}
+
+// writeConfig writes the values of all flags, including the default
+// values, into a file, so that the run can be repeated by -config.
+// The input files are written as a list.
+func writeConfig(filename string, fs *flag.FlagSet) error {
+	config := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		switch {
+		case f.Name == "config":
+		case f.Name == "personsin":
+			config[f.Name] = []string{}
+			if f.Value.String() != "" {
+				config[f.Name] = strings.Split(f.Value.String(), ",")
+			}
+		default:
+			if getter, ok := f.Value.(flag.Getter); ok {
+				config[f.Name] = getter.Get()
+			} else {
+				config[f.Name] = f.Value.String()
+			}
+		}
+	})
+	bytes, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(bytes, '\n'), os.ModePerm)
+}
+
+// isSameFile reports whether two filenames refer to the same file.
+func isSameFile(filename1, filename2 string) bool {
+	info1, err := os.Stat(filename1)
+	if err != nil {
+		return false
+	}
+	info2, err := os.Stat(filename2)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(info1, info2)
+}
+
+// outputDir returns the directory of the first output file in
+// alphabetical order of the flag names. Output files are given by
+// flags whose names end in "out". If there is no output file the
+// current directory is used.
+func outputDir(fs *flag.FlagSet) string {
+	dir := "."
+	isFound := false
+	fs.Visit(func(f *flag.Flag) {
+		if !isFound && strings.HasSuffix(f.Name, "out") && f.Value.String() != "" {
+			dir = filepath.Dir(f.Value.String())
+			isFound = true
+		}
+	})
+	return dir
+}
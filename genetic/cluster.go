@@ -0,0 +1,277 @@
+package genetic
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Cluster is a group of genetically similar persons.
+type Cluster struct {
+	// Name is the name of the cluster, for example "C1".
+	Name string
+	// Members contains the indices of the members in the
+	// slice of persons that has been clustered.
+	Members []int
+	Persons []*Person
+	// Modal is the modal haplotype of the cluster.
+	Modal *Person
+	// AverageDistance is the average genetic distance of the
+	// members from the modal haplotype. It is a measure for
+	// the diversity of the cluster.
+	AverageDistance float64
+	// StandardDeviation is the standard deviation of the
+	// members' distances from the modal haplotype.
+	StandardDeviation float64
+}
+
+// noiseName is the name of the cluster that contains all persons
+// who do not belong to any cluster.
+const noiseName = "noise"
+
+// IsNoise reports whether the cluster contains the persons who do
+// not belong to any cluster or group.
+func (c *Cluster) IsNoise() bool {
+	return c.Name == noiseName
+}
+
+// newCluster creates a cluster of persons and calculates it's
+// modal haplotype and diversity.
+func newCluster(name string, members []int, persons []*Person, mutationRates YstrMarkers, model DistanceModel) *Cluster {
+	cluster := Cluster{
+		Name:    name,
+		Members: members,
+		Persons: make([]*Person, len(members)),
+	}
+	for i, member := range members {
+		cluster.Persons[i] = persons[member]
+	}
+	cluster.Modal = ModalHaplotypeWith(cluster.Persons, model.Microalleles)
+	distances := make([]float64, len(cluster.Persons))
+	for i, p := range cluster.Persons {
+		distances[i] = model.Distance(cluster.Modal.YstrMarkers, p.YstrMarkers, mutationRates)
+	}
+	// The average is 0 for clusters with a single member.
+	cluster.AverageDistance, cluster.StandardDeviation, _ = Average(distances)
+	return &cluster
+}
+
+// newClusters creates clusters from a slice that assigns a cluster
+// number to each person. Clusters are numbered from 0. Persons with
+// a negative number are put into a cluster named "noise".
+func newClusters(assignment []int, persons []*Person, mutationRates YstrMarkers, model DistanceModel) []*Cluster {
+	groups := make([][]int, 0)
+	noise := make([]int, 0)
+	for person, number := range assignment {
+		if number < 0 {
+			noise = append(noise, person)
+			continue
+		}
+		for len(groups) <= number {
+			groups = append(groups, make([]int, 0))
+		}
+		groups[number] = append(groups[number], person)
+	}
+	result := make([]*Cluster, 0, len(groups)+1)
+	for _, members := range groups {
+		if len(members) > 0 {
+			name := "C" + strconv.Itoa(len(result)+1)
+			result = append(result, newCluster(name, members, persons, mutationRates, model))
+		}
+	}
+	if len(noise) > 0 {
+		result = append(result, newCluster(noiseName, noise, persons, mutationRates, model))
+	}
+	return result
+}
+
+// HierarchicalClusters partitions persons by agglomerative hierarchical
+// clustering with average linkage (UPGMA). Clusters are merged as long
+// as the average distance between their members is not larger than cutoff.
+//
+// dm must be the distance matrix for persons. mutationRates and model are
+// used to calculate the diversity of each cluster.
+func HierarchicalClusters(persons []*Person, dm *DistanceMatrix, cutoff float64, mutationRates YstrMarkers, model DistanceModel) []*Cluster {
+	// Start with one cluster for each person.
+	groups := make([][]int, dm.Size)
+	for i := range groups {
+		groups[i] = []int{i}
+	}
+	// linkage returns the average distance between two groups.
+	linkage := func(a, b []int) float64 {
+		sum := 0.0
+		for _, i := range a {
+			for _, j := range b {
+				sum += dm.Values[i][j]
+			}
+		}
+		return sum / float64(len(a)*len(b))
+	}
+	for len(groups) > 1 {
+		// Find the nearest pair of groups.
+		best := math.Inf(1)
+		bestA, bestB := -1, -1
+		for a := 0; a < len(groups); a++ {
+			for b := a + 1; b < len(groups); b++ {
+				d := linkage(groups[a], groups[b])
+				if d < best {
+					best, bestA, bestB = d, a, b
+				}
+			}
+		}
+		if bestA < 0 || best > cutoff {
+			break
+		}
+		groups[bestA] = append(groups[bestA], groups[bestB]...)
+		groups = append(groups[:bestB], groups[bestB+1:]...)
+	}
+	assignment := make([]int, dm.Size)
+	for number, group := range groups {
+		for _, person := range group {
+			assignment[person] = number
+		}
+	}
+	return newClusters(assignment, persons, mutationRates, model)
+}
+
+// DensityClusters partitions persons by density based clustering
+// (DBSCAN, https://en.wikipedia.org/wiki/DBSCAN).
+// A person is a core member of a cluster if at least minPoints persons,
+// including itself, are within a distance of radius. Persons who are
+// not within reach of a core member are put into a cluster named "noise".
+//
+// dm must be the distance matrix for persons. mutationRates and model are
+// used to calculate the diversity of each cluster.
+func DensityClusters(persons []*Person, dm *DistanceMatrix, radius float64, minPoints int, mutationRates YstrMarkers, model DistanceModel) []*Cluster {
+	const (
+		unvisited = -2
+		noise     = -1
+	)
+	// neighbours returns all persons within radius.
+	neighbours := func(person int) []int {
+		result := make([]int, 0)
+		for i := 0; i < dm.Size; i++ {
+			if dm.Values[person][i] <= radius {
+				result = append(result, i)
+			}
+		}
+		return result
+	}
+	assignment := make([]int, dm.Size)
+	for i := range assignment {
+		assignment[i] = unvisited
+	}
+	number := 0
+	for person := 0; person < dm.Size; person++ {
+		if assignment[person] != unvisited {
+			continue
+		}
+		seeds := neighbours(person)
+		if len(seeds) < minPoints {
+			assignment[person] = noise
+			continue
+		}
+		// Expand a new cluster.
+		assignment[person] = number
+		for k := 0; k < len(seeds); k++ {
+			next := seeds[k]
+			if assignment[next] == noise {
+				assignment[next] = number
+			}
+			if assignment[next] != unvisited {
+				continue
+			}
+			assignment[next] = number
+			if reachable := neighbours(next); len(reachable) >= minPoints {
+				seeds = append(seeds, reachable...)
+			}
+		}
+		number++
+	}
+	return newClusters(assignment, persons, mutationRates, model)
+}
+
+// String returns a summary of the cluster containing its members,
+// diversity and modal haplotype.
+func (c *Cluster) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Cluster %s, %d persons, distance from modal haplotype: %.2f ± %.2f\n",
+		c.Name, len(c.Persons), c.AverageDistance, c.StandardDeviation))
+	buffer.WriteString("Members:")
+	for _, p := range c.Persons {
+		buffer.WriteString(" " + p.Label)
+	}
+	buffer.WriteString("\nModal:")
+	// Write modal values up to the last marker that has a value.
+	last := 0
+	for i := 0; i < MaxMarkers; i++ {
+		if c.Modal.YstrMarkers[i] > 0 {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		buffer.WriteString(" " + strconv.FormatFloat(c.Modal.YstrMarkers[i], 'f', -1, 64))
+	}
+	buffer.WriteString("\n")
+	return buffer.String()
+}
+
+// ClustersByGroup creates a cluster for each group of persons.
+// Persons are grouped by their Group field. Persons without a
+// group are put into a cluster named "noise".
+// Clusters are ordered by the first appearance of their group.
+func ClustersByGroup(persons []*Person, mutationRates YstrMarkers, model DistanceModel) []*Cluster {
+	return clustersBy(persons, func(p *Person) string { return p.Group }, mutationRates, model)
+}
+
+// ClustersByOrigin creates a cluster for each origin of persons,
+// like ClustersByGroup but using the Origin field.
+func ClustersByOrigin(persons []*Person, mutationRates YstrMarkers, model DistanceModel) []*Cluster {
+	return clustersBy(persons, func(p *Person) string { return p.Origin }, mutationRates, model)
+}
+
+// clustersBy creates a cluster for each value of key.
+// Persons with an empty key are put into a cluster named "noise".
+func clustersBy(persons []*Person, key func(*Person) string, mutationRates YstrMarkers, model DistanceModel) []*Cluster {
+	names := make([]string, 0)
+	members := make(map[string][]int)
+	noise := make([]int, 0)
+	for i, p := range persons {
+		name := strings.TrimSpace(key(p))
+		if name == "" {
+			noise = append(noise, i)
+			continue
+		}
+		if _, exists := members[name]; !exists {
+			names = append(names, name)
+		}
+		members[name] = append(members[name], i)
+	}
+	result := make([]*Cluster, 0, len(names)+1)
+	for _, name := range names {
+		result = append(result, newCluster(name, members[name], persons, mutationRates, model))
+	}
+	if len(noise) > 0 {
+		result = append(result, newCluster(noiseName, noise, persons, mutationRates, model))
+	}
+	return result
+}
+
+// ClustersTable returns a table that contains the size, the average
+// distance from the modal haplotype with its standard deviation and
+// an age estimate in years for each cluster.
+// The age is the average distance multiplied by generationDistance
+// and calibrationFactor, as in DistanceMatrix.Years. There is no
+// correction for the Poisson distribution and back mutations.
+func ClustersTable(clusters []*Cluster, generationDistance, calibrationFactor float64) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%-20s %8s %10s %10s %10s\n", "Group", "Persons", "Distance", "SD", "Years"))
+	for _, c := range clusters {
+		years := math.Trunc(c.AverageDistance * generationDistance * calibrationFactor)
+		buffer.WriteString(fmt.Sprintf("%-20s %8d %10.2f %10.2f %10g\n",
+			c.Name, len(c.Persons), c.AverageDistance, c.StandardDeviation, years))
+	}
+	return buffer.String()
+}
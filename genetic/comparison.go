@@ -0,0 +1,127 @@
+package genetic
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Comparison contains the detailed comparison of the Y-STR
+// markers of two persons.
+type Comparison struct {
+	Person1 *Person
+	Person2 *Person
+	// Markers contains the contribution of each marker
+	// that has been compared.
+	Markers []MarkerDistance
+	// Distance is the genetic distance between both persons.
+	Distance float64
+}
+
+// NewComparison compares the Y-STR markers of two persons marker by marker.
+func NewComparison(person1, person2 *Person, mutationRates YstrMarkers, model DistanceModel) *Comparison {
+	result := Comparison{
+		Person1:  person1,
+		Person2:  person2,
+		Markers:  make([]MarkerDistance, 0, MaxMarkers),
+		Distance: model.Distance(person1.YstrMarkers, person2.YstrMarkers, mutationRates),
+	}
+	for _, marker := range model.MarkerDistances(person1.YstrMarkers, person2.YstrMarkers, mutationRates) {
+		if marker.IsCompared() {
+			result.Markers = append(result.Markers, marker)
+		}
+	}
+	return &result
+}
+
+// Drivers returns the markers that contribute most to the genetic distance,
+// ordered by their contribution. The result contains the smallest number of
+// markers that make up at least the given share of the sum of all
+// contributions. share must be > 0 and <= 1.
+func (c *Comparison) Drivers(share float64) []MarkerDistance {
+	sorted := make([]MarkerDistance, 0, len(c.Markers))
+	total := 0.0
+	for _, marker := range c.Markers {
+		if marker.Distance > 0 {
+			sorted = append(sorted, marker)
+			total += marker.Distance
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Distance > sorted[j].Distance
+	})
+	sum := 0.0
+	for i, marker := range sorted {
+		sum += marker.Distance
+		if sum >= share*total {
+			return sorted[:i+1]
+		}
+	}
+	return sorted
+}
+
+// String returns the comparison as a human readable table.
+// Markers that contribute most to the distance are marked by "<<".
+func (c *Comparison) String() string {
+	drivers := make(map[int]bool)
+	for _, marker := range c.Drivers(0.5) {
+		drivers[marker.Index] = true
+	}
+	nCompared := 0
+	for _, marker := range c.Markers {
+		nCompared += marker.NCompared
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Comparison of %s and %s\n", c.Person1.Label, c.Person2.Label))
+	buffer.WriteString(fmt.Sprintf("%-12s %14s %14s %10s %10s %12s\n",
+		"Marker", c.Person1.Label, c.Person2.Label, "Difference", "Rate", "Contribution"))
+	for _, marker := range c.Markers {
+		line := fmt.Sprintf("%-12s %14s %14s %10g %10.4g %12.4g",
+			markerName(marker.Index),
+			markerValues(c.Person1.YstrMarkers, marker.Index),
+			markerValues(c.Person2.YstrMarkers, marker.Index),
+			marker.Difference, marker.MutationRate, marker.Distance)
+		if drivers[marker.Index] {
+			line += " <<"
+		}
+		buffer.WriteString(line + "\n")
+	}
+	buffer.WriteString(fmt.Sprintf("Values compared: %d, Genetic distance: %.4g\n", nCompared, c.Distance))
+	return buffer.String()
+}
+
+// markerName returns the name of the marker at index.
+// For palindromic markers the name of the marker without
+// suffix is returned.
+func markerName(index int) string {
+	name := YstrMarkerTable[index].InternalName
+	if start, isPalindromic := palindromicStart(index); isPalindromic {
+		name = YstrMarkerTable[start].InternalName
+		for _, suffix := range []string{".1", "a", "A"} {
+			name = strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// markerValues returns the values of the marker at index as text.
+// Values of palindromic markers are separated by "-".
+func markerValues(ystr YstrMarkers, index int) string {
+	start, isPalindromic := palindromicStart(index)
+	values := ystr[start : index+1]
+	if index == DYS464end {
+		values = concat(values, ystr[DYS464extStart:DYS464extEnd+1])
+	}
+	texts := make([]string, 0, len(values))
+	for i, value := range values {
+		// Omit missing extra values of palindromic markers.
+		if value == 0 && isPalindromic && i > 0 {
+			continue
+		}
+		texts = append(texts, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return strings.Join(texts, "-")
+}
@@ -0,0 +1,129 @@
+package genetic
+
+import (
+	"fmt"
+)
+
+// Diversity calculates the unbiased diversity (Nei 1987) from the
+// number of occurrences of each value: h = n / (n-1) * (1 - sum(p²)),
+// where n is the number of samples and p are the frequencies of the
+// values. It is the probability that two randomly chosen samples
+// have different values. For less than two samples it is 0.
+func Diversity(counts []int) float64 {
+	n := 0.0
+	for _, count := range counts {
+		n += float64(count)
+	}
+	if n < 2 {
+		return 0
+	}
+	sum := 0.0
+	for _, count := range counts {
+		p := float64(count) / n
+		sum += p * p
+	}
+	return n / (n - 1) * (1 - sum)
+}
+
+// counts returns the number of occurrences of each value of a marker.
+func (s *MarkerStatistics) counts(marker int) []int {
+	result := make([]int, 0, len(s.Markers[marker].ValuesOccurrences))
+	for _, count := range s.Markers[marker].ValuesOccurrences {
+		result = append(result, count)
+	}
+	return result
+}
+
+// GeneDiversity returns the gene diversity (Nei) of a marker,
+// see Diversity.
+func (s *MarkerStatistics) GeneDiversity(marker int) float64 {
+	return Diversity(s.counts(marker))
+}
+
+// AlleleVariance returns the sample variance of a marker's values
+// in repeats. It is 0 for less than two values.
+func (s *MarkerStatistics) AlleleVariance(marker int) float64 {
+	n, sum := 0.0, 0.0
+	for value, count := range s.Markers[marker].ValuesOccurrences {
+		n += float64(count)
+		sum += value * float64(count)
+	}
+	if n < 2 {
+		return 0
+	}
+	mean := sum / n
+	squares := 0.0
+	for value, count := range s.Markers[marker].ValuesOccurrences {
+		squares += (value - mean) * (value - mean) * float64(count)
+	}
+	return squares / (n - 1)
+}
+
+// EffectiveAlleles returns the effective number of alleles of a
+// marker: 1 / sum(p²), where p are the frequencies of the values.
+// It is 0 for markers without values.
+func (s *MarkerStatistics) EffectiveAlleles(marker int) float64 {
+	n := float64(s.nTested(marker))
+	if n == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, count := range s.Markers[marker].ValuesOccurrences {
+		p := float64(count) / n
+		sum += p * p
+	}
+	return 1 / sum
+}
+
+// DiversitySummary summarizes the diversity of all markers
+// that have values.
+type DiversitySummary struct {
+	NSamples int
+	// NMarkers is the number of markers that have been tested by
+	// all samples. Haplotypes are compared on these markers.
+	NMarkers           int
+	NHaplotypes        int
+	HaplotypeDiversity float64
+	// MeanGeneDiversity, MeanAlleleVariance and MeanEffectiveAlleles
+	// are the averages over all markers that have values.
+	MeanGeneDiversity    float64
+	MeanAlleleVariance   float64
+	MeanEffectiveAlleles float64
+}
+
+// Summary returns the diversity summary of all markers that have values.
+func (s *MarkerStatistics) Summary() DiversitySummary {
+	result := DiversitySummary{
+		NSamples:           s.NSamples,
+		NHaplotypes:        s.NHaplotypes,
+		HaplotypeDiversity: s.HaplotypeDiversity,
+	}
+	nValues := 0
+	for marker := range s.Markers {
+		if s.Markers[marker].ValuesOccurrences == nil {
+			continue
+		}
+		if s.Markers[marker].FrequencyAmongSamples == 1 {
+			result.NMarkers++
+		}
+		nValues++
+		result.MeanGeneDiversity += s.GeneDiversity(marker)
+		result.MeanAlleleVariance += s.AlleleVariance(marker)
+		result.MeanEffectiveAlleles += s.EffectiveAlleles(marker)
+	}
+	if nValues > 0 {
+		n := float64(nValues)
+		result.MeanGeneDiversity /= n
+		result.MeanAlleleVariance /= n
+		result.MeanEffectiveAlleles /= n
+	}
+	return result
+}
+
+// String returns the summary in a single line.
+func (d DiversitySummary) String() string {
+	return fmt.Sprintf("Samples: %d, Markers: %d, Haplotypes: %d, Haplotype diversity: %.4f, "+
+		"Gene diversity: %.4f, Allele variance: %.4f, Effective alleles: %.4f",
+		d.NSamples, d.NMarkers, d.NHaplotypes, d.HaplotypeDiversity,
+		d.MeanGeneDiversity, d.MeanAlleleVariance, d.MeanEffectiveAlleles)
+}
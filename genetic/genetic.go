@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 )
 
@@ -30,6 +31,13 @@ const (
 	DYS389i  = 9
 	DYS389ii = 11
 
+	// Multi-copy markers that are not palindromic.
+	// Their values are compared one by one.
+	DYS385start = 4
+	DYS385end   = 5
+	DYS459start = 13
+	DYS459end   = 14
+
 	// The program uses the infinite alleles mutation model
 	// for these palindromic markers.
 	DYS464start    = 21
@@ -215,7 +223,13 @@ type Person struct {
 	Label    string
 	Ancestor string
 	Origin   string
+	// Group is the name of a group of related persons,
+	// for example a cluster or a subclade.
+	Group string
 	YstrMarkers
+	// Imputed contains the indices of marker values that have
+	// not been tested but have been estimated, see Impute.
+	Imputed []int
 }
 
 // anonymize deletes personal data with the exception of the
@@ -227,7 +241,9 @@ func (p *Person) anonymize() *Person {
 		Label:       "__________",
 		Ancestor:    "",
 		Origin:      "",
-		YstrMarkers: p.YstrMarkers}
+		Group:       p.Group,
+		YstrMarkers: p.YstrMarkers,
+		Imputed:     p.Imputed}
 }
 
 // markerSet returns a person who's marker set has been reduced
@@ -243,12 +259,7 @@ func (p *Person) markerSet(nMarkers int) (person *Person, isComplete bool) {
 	}
 	// Check if the marker set is complete
 	for i := 0; i < nMarkers; i++ {
-		if person.YstrMarkers[i] == 0 &&
-			// The palindromic marker DYS464 is not counted here.
-			// In all cases I know, at least four values are reported
-			// for DYS464, but in theory there could be less. So I
-			// ignore this marker here, just in case.
-			(i <= DYS464start || i >= DYS464end) {
+		if person.YstrMarkers[i] == 0 && isRequired(i) {
 			isComplete = false
 			break
 		}
@@ -256,6 +267,16 @@ func (p *Person) markerSet(nMarkers int) (person *Person, isComplete bool) {
 	return person, isComplete
 }
 
+// isRequired reports whether a value for the marker at index must exist
+// for a person to be considered as tested for a marker set.
+func isRequired(index int) bool {
+	// The palindromic marker DYS464 is not counted here.
+	// In all cases I know, at least four values are reported
+	// for DYS464, but in theory there could be less. So I
+	// ignore this marker here, just in case.
+	return index <= DYS464start || index >= DYS464end
+}
+
 // YstrMarkers contains the values for the Y-STR markers.
 // The first 111 markers are in Family Tree DNA order.
 // The detailed layout is defined by YstrMarkerTable.
@@ -293,7 +314,7 @@ func distancesMarkerCount(ystr1, ystr2 YstrMarkers) (distances []float64, nCompa
 	distances = make([]float64, MaxMarkers)
 	for i := 0; i < MaxMarkers; i++ {
 		if ystr1[i] > 0 && ystr2[i] > 0 {
-			distances[i] = math.Abs(ystr1[i] - ystr2[i])
+			distances[i] = steps(ystr1[i], ystr2[i], MicroalleleFractional)
 			nCompared++
 		}
 	}
@@ -331,7 +352,7 @@ func distanceSimpleCount(ystr1, ystr2, mutationRates YstrMarkers) float64 {
 // If one value or the mutation rate for a specific marker is
 // set to 0 it is excluded from the calculation.
 func DistanceInfiniteAlleles(ystr1, ystr2, mutationRates YstrMarkers) float64 {
-	return distance(ystr1, ystr2, mutationRates, true)
+	return distance(ystr1, ystr2, mutationRates, DistanceModel{InfiniteAlleles: true})
 }
 
 // DistanceHybrid calculates the genetic distance between two sets of
@@ -343,13 +364,79 @@ func DistanceInfiniteAlleles(ystr1, ystr2, mutationRates YstrMarkers) float64 {
 // If one value or the mutation rate for a specific marker is
 // set to 0 it is excluded from the calculation.
 func DistanceHybrid(ystr1, ystr2, mutationRates YstrMarkers) float64 {
-	return distance(ystr1, ystr2, mutationRates, false)
+	return distance(ystr1, ystr2, mutationRates, DistanceModel{})
+}
+
+// DistanceModel holds the settings for a genetic distance calculation.
+// The zero value is the hybrid mutation model with microalleles
+// counted as fractional repeats and palindromic markers scored
+// like Family Tree DNA does.
+type DistanceModel struct {
+	// InfiniteAlleles determines if the infinite alleles mutation
+	// model is used for all markers. Otherwise the hybrid mutation
+	// model is used.
+	InfiniteAlleles bool
+	// Microalleles determines how microalleles are scored.
+	Microalleles MicroallelePolicy
+	// Palindromic determines how palindromic markers are scored.
+	Palindromic PalindromicMethod
+}
+
+// Distance calculates the genetic distance between two sets of
+// Y-STR markers using the settings of the model.
+// It satisfies the DistanceFunc type.
+func (m DistanceModel) Distance(ystr1, ystr2, mutationRates YstrMarkers) float64 {
+	return distance(ystr1, ystr2, mutationRates, m)
+}
+
+// MarkerDistance is the contribution of a single marker to the
+// genetic distance between two sets of Y-STR markers.
+type MarkerDistance struct {
+	// Index is the index of the marker. For palindromic markers
+	// this is the index of the last value of the marker.
+	Index int
+	// Difference is the number of mutations between the two
+	// values without regard to the mutation rate.
+	Difference float64
+	// MutationRate is the mutation rate used for the marker.
+	MutationRate float64
+	// Distance is the weighted contribution to the genetic distance.
+	// It is Difference divided by MutationRate.
+	Distance float64
+	// NCompared is the number of values that have been compared.
+	// It is larger than 1 for palindromic markers and 0 if the
+	// marker has not been compared.
+	NCompared int
+}
+
+// IsCompared reports whether the marker was included in the calculation.
+func (d MarkerDistance) IsCompared() bool {
+	return d.NCompared > 0
+}
+
+// NCompared returns the number of marker values that are compared
+// when the genetic distance between two sets of Y-STR markers
+// is calculated by Distance.
+func (m DistanceModel) NCompared(ystr1, ystr2, mutationRates YstrMarkers) int {
+	nCompared := 0
+	for _, marker := range markerDistances(ystr1, ystr2, mutationRates, m) {
+		nCompared += marker.NCompared
+	}
+	return nCompared
+}
+
+// MarkerDistances returns the contribution of every marker to the
+// genetic distance calculated by Distance.
+// The result contains MaxMarkers entries. For palindromic markers
+// the whole contribution is stored at the last index of the marker.
+func (m DistanceModel) MarkerDistances(ystr1, ystr2, mutationRates YstrMarkers) []MarkerDistance {
+	return markerDistances(ystr1, ystr2, mutationRates, m)
 }
 
 // distance calculates the genetic distance between two sets of
 // Y-STR markers.
-// The parameter isInfiniteAlleles determines if the infinite alleles
-// mutation model is used or a hybrid mutation model.
+// The model determines if the infinite alleles mutation model
+// is used or a hybrid mutation model and how microalleles are scored.
 // In case of the hybrid mutation model most markers are counted
 // stepwise but for palindromic markers the infinite
 // allele model is used. More information about mutation models
@@ -358,53 +445,74 @@ func DistanceHybrid(ystr1, ystr2, mutationRates YstrMarkers) float64 {
 // set to 0 it is excluded from the calculation.
 //
 // This method may change in future versions.
-func distance(ystr1, ystr2, mutationRates YstrMarkers, isInfiniteAlleles bool) float64 {
+func distance(ystr1, ystr2, mutationRates YstrMarkers, model DistanceModel) float64 {
+	markers := markerDistances(ystr1, ystr2, mutationRates, model)
 	// nCompared is the number of markers that are actually compared.
 	// We compare only those marker for which the results of two persons
 	// and the mutation rate exist.
-	var nCompared = 0
+	nCompared := 0
+	distances := make([]float64, len(markers))
+	for i, marker := range markers {
+		distances[i] = marker.Distance
+		nCompared += marker.NCompared
+	}
+	return average(distances, nCompared)
+}
+
+// markerDistances calculates the contribution of every marker to the
+// genetic distance between two sets of Y-STR markers.
+// See distance for a description of the calculation.
+func markerDistances(ystr1, ystr2, mutationRates YstrMarkers, model DistanceModel) []MarkerDistance {
+	result := make([]MarkerDistance, MaxMarkers)
+	for i := range result {
+		result[i].Index = i
+		result[i].MutationRate = mutationRates[i]
+	}
+
+	// set stores the difference for a compared marker.
+	var set = func(i int, difference float64, nCompared int) {
+		result[i].Difference = difference
+		result[i].Distance = difference / mutationRates[i]
+		result[i].NCompared = nCompared
+	}
 
 	// stepwise calculates the genetic distance for one marker of
 	// two persons using the stepwise mutation model
 	// (http://nitro.biosci.arizona.edu/ftDNA/models.html).
-	var stepwise = func(marker1, marker2, mutationRate float64) (distance float64) {
-		if marker1 > 0 && marker2 > 0 && mutationRate > 0 {
-			distance = math.Abs(marker1-marker2) / mutationRate
-			nCompared++
+	var stepwise = func(i int) {
+		if ystr1[i] > 0 && ystr2[i] > 0 && mutationRates[i] > 0 {
+			set(i, steps(ystr1[i], ystr2[i], model.Microalleles), 1)
 		}
-		return distance
 	}
 
 	// infinite calculates the genetic distance for one marker of
 	// two persons using the infinite allelles mutation model
 	// (http://nitro.biosci.arizona.edu/ftDNA/models.html).
-	var infinite = func(marker1, marker2, mutationRate float64) (distance float64) {
-		if marker1 > 0 && marker2 > 0 && mutationRate > 0 {
-			if marker1 != marker2 {
-				distance = 1 / mutationRate
+	var infinite = func(i int) {
+		if ystr1[i] > 0 && ystr2[i] > 0 && mutationRates[i] > 0 {
+			if normalizeAllele(ystr1[i]) != normalizeAllele(ystr2[i]) {
+				set(i, 1, 1)
 			} else {
-				distance = 0
+				set(i, 0, 1)
 			}
-			nCompared++
 		}
-		return distance
 	}
 
 	// singleDistance is the distance function that is used for most markers.
-	var singleDistance func(marker1, marker2, mutationRate float64) (distance float64)
-	if isInfiniteAlleles == true {
+	var singleDistance func(i int)
+	if model.InfiniteAlleles == true {
 		singleDistance = infinite
 	} else {
 		singleDistance = stepwise
 	}
 
-	// palindromic calculates the genetic distance of palindromic markers.
-	var palindromic = func(markers1, markers2 []float64, mutationRate float64) (distance float64) {
-		if isValidPalindromic(markers1, markers2, mutationRate) {
-			distance = distancePalindromic(markers1, markers2, mutationRate)
-			nCompared += len(markers1)
+	// palindromic calculates the genetic distance of palindromic markers
+	// and stores the result at the index end.
+	// nCompared is the number of values that is counted for the marker.
+	var palindromic = func(markers1, markers2 []float64, end, nCompared int) {
+		if model.Palindromic != PalindromicIgnore && isValidPalindromic(markers1, markers2, mutationRates[end]) {
+			set(end, model.distancePalindromic(markers1, markers2, 1), nCompared)
 		}
-		return distance
 	}
 
 	// Check if values for special markers exist.
@@ -417,63 +525,59 @@ func distance(ystr1, ystr2, mutationRates YstrMarkers, isInfiniteAlleles bool) f
 	}
 
 	// Calculate distance for every single marker.
-	distances := make([]float64, MaxMarkers)
 	for i := 0; i < DYS389ii; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
 	if DYS389exists && mutationRates[DYS389ii] > 0 {
-		if isInfiniteAlleles == true {
-			distances[DYS389ii] = distanceDYS389iiInfiniteAlleles(ystr1[DYS389i], ystr1[DYS389ii], ystr2[DYS389i], ystr2[DYS389ii]) / mutationRates[DYS389ii]
+		if model.InfiniteAlleles == true {
+			set(DYS389ii, distanceDYS389iiInfiniteAlleles(ystr1[DYS389i], ystr1[DYS389ii], ystr2[DYS389i], ystr2[DYS389ii]), 1)
 		} else {
-			distances[DYS389ii] = distanceDYS389ii(ystr1[DYS389i], ystr1[DYS389ii], ystr2[DYS389i], ystr2[DYS389ii]) / mutationRates[DYS389ii]
+			set(DYS389ii, distanceDYS389ii(ystr1[DYS389i], ystr1[DYS389ii], ystr2[DYS389i], ystr2[DYS389ii], model.Microalleles), 1)
 		}
-		nCompared++
 	}
 	for i := DYS389ii + 1; i < DYS464start; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
 	// DYS464: For compatibilty reasons DYS464 is stored at different range positions.
 	// So we need to put all values back together.
+	// The extremely rare cases of more than 4 DYS464 markers are ignored for counting.
+	// I assume that the typical mutation rates have been derived using the common four markers.
 	values1 := concat(ystr1[DYS464start:DYS464end+1], ystr1[DYS464extStart:DYS464extEnd+1])
 	values2 := concat(ystr2[DYS464start:DYS464end+1], ystr2[DYS464extStart:DYS464extEnd+1])
-	if isValidPalindromic(values1, values2, mutationRates[DYS464end]) {
-		distances[DYS464end] = distancePalindromic(values1, values2, mutationRates[DYS464end])
-		// The extremely rare cases of more than 4 DYS464 markers are ignored for counting.
-		// I assume that the typical mutation rates have been derived using the common four markers.
-		nCompared += DYS464end - DYS464start + 1
-	}
+	palindromic(values1, values2, DYS464end, DYS464end-DYS464start+1)
 	for i := DYS464end + 1; i < YCAIIstart; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
-	distances[YCAIIend] = palindromic(ystr1[YCAIIstart:YCAIIend+1], ystr2[YCAIIstart:YCAIIend+1], mutationRates[YCAIIend])
+	palindromic(ystr1[YCAIIstart:YCAIIend+1], ystr2[YCAIIstart:YCAIIend+1], YCAIIend, YCAIIend-YCAIIstart+1)
 	for i := YCAIIend + 1; i < CDYstart; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
-	distances[CDYend] = palindromic(ystr1[CDYstart:CDYend+1], ystr2[CDYstart:CDYend+1], mutationRates[CDYend])
+	palindromic(ystr1[CDYstart:CDYend+1], ystr2[CDYstart:CDYend+1], CDYend, CDYend-CDYstart+1)
 	for i := CDYend + 1; i < DYF395S1start; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
-	distances[DYF395S1end] = palindromic(ystr1[DYF395S1start:DYF395S1end+1], ystr2[DYF395S1start:DYF395S1end+1], mutationRates[DYF395S1end])
+	palindromic(ystr1[DYF395S1start:DYF395S1end+1], ystr2[DYF395S1start:DYF395S1end+1], DYF395S1end, DYF395S1end-DYF395S1start+1)
 	for i := DYF395S1end + 1; i < DYS413start; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
-	distances[DYS413end] = palindromic(ystr1[DYS413start:DYS413end+1], ystr2[DYS413start:DYS413end+1], mutationRates[DYS413end])
+	palindromic(ystr1[DYS413start:DYS413end+1], ystr2[DYS413start:DYS413end+1], DYS413end, DYS413end-DYS413start+1)
 	for i := DYS413end + 1; i < DYS526start; i++ {
-		distances[i] = singleDistance(ystr1[i], ystr2[i], mutationRates[i])
+		singleDistance(i)
 	}
 	// Distances for palindromic markers outside Family Tree DNA's 111 marker range.
 	for _, region := range palindromicRegions {
-		distances[region[1]] = palindromic(ystr1[region[0]:region[1]+1], ystr2[region[0]:region[1]+1], mutationRates[region[1]])
+		palindromic(ystr1[region[0]:region[1]+1], ystr2[region[0]:region[1]+1], region[1], region[1]-region[0]+1)
 	}
-	return average(distances, nCompared)
+	return result
 }
 
 // distanceDYS389ii calculates the genetic distance for the DYS389ii
 // marker. This marker is a special case because it includes DYS389i
 //
-// The input parameters are the DYS389 values for persons a and b.
-func distanceDYS389ii(aDYS389i, aDYS389ii, bDYS389i, bDYS389ii float64) float64 {
-	return math.Abs((aDYS389ii - aDYS389i) - (bDYS389ii - bDYS389i))
+// The input parameters are the DYS389 values for persons a and b
+// and the policy used for microalleles.
+func distanceDYS389ii(aDYS389i, aDYS389ii, bDYS389i, bDYS389ii float64, policy MicroallelePolicy) float64 {
+	return steps(aDYS389ii-aDYS389i, bDYS389ii-bDYS389i, policy)
 }
 
 // distanceDYS389iiInfiniteAlleles calculates the genetic distance for the DYS389ii
@@ -481,7 +585,7 @@ func distanceDYS389ii(aDYS389i, aDYS389ii, bDYS389i, bDYS389ii float64) float64
 //
 // The input parameters are the DYS389 values for persons a and b.
 func distanceDYS389iiInfiniteAlleles(aDYS389i, aDYS389ii, bDYS389i, bDYS389ii float64) float64 {
-	if aDYS389ii-aDYS389i != bDYS389ii-bDYS389i {
+	if normalizeAllele(aDYS389ii-aDYS389i) != normalizeAllele(bDYS389ii-bDYS389i) {
 		return 1
 	} else {
 		return 0
@@ -495,6 +599,7 @@ func distanceDYS389iiInfiniteAlleles(aDYS389i, aDYS389ii, bDYS389i, bDYS389ii fl
 // It uses the infinite allele model and differs from
 // the calculation described at genebase
 // (http://www.genebase.com/learning/article/46).
+// Other methods can be selected by DistanceModel.Palindromic.
 //
 // ystr1 and ystr2 contain the palindromic values for each person.
 func distancePalindromic(ystr1, ystr2 []float64, mutationRate float64) float64 {
@@ -529,7 +634,7 @@ func distancePalindromic(ystr1, ystr2 []float64, mutationRate float64) float64 {
 	for i := 0; i < len(list1); i++ {
 		isMatchingMarker := false
 		for j := 0; j < len(list2); j++ {
-			if list1[i] == list2[j] {
+			if normalizeAllele(list1[i]) == normalizeAllele(list2[j]) {
 				isMatchingMarker = true
 				// Set to 0 because it had a match.
 				list2[j] = 0
@@ -585,7 +690,19 @@ func concat(s1, s2 []float64) []float64 {
 // ModalHaplotype calculates the modal haplotype for a group of persons.
 // The modal value for a marker is the value with the highest occurence.
 // If two values have the same frequency the lower one is chosen.
+// Microalleles are treated as fractional repeats.
 func ModalHaplotype(persons []*Person) *Person {
+	return ModalHaplotypeWith(persons, MicroalleleFractional)
+}
+
+// ModalHaplotypeWith calculates the modal haplotype for a group of persons
+// using the specified policy for microalleles.
+// The modal value for a marker is the value with the highest occurence.
+// If two values have the same frequency the lower one is chosen.
+// If the policy is MicroalleleStep or MicroalleleInfinite a microallele
+// counts as an extra mutation event. In this case a complete allele
+// is preferred over a microallele of the same frequency.
+func ModalHaplotypeWith(persons []*Person, policy MicroallelePolicy) *Person {
 	modal := Person{
 		ID:       "modal",
 		Name:     "modal",
@@ -595,35 +712,49 @@ func ModalHaplotype(persons []*Person) *Person {
 	}
 	// Calculate modal value for each marker.
 	for marker := 0; marker < MaxMarkers; marker++ {
-		// cMarkers maps marker values to the count of that value.
-		cMarkers := make(map[float64]int)
-		// Count marker values.
-		for _, person := range persons {
-			markerValue := person.YstrMarkers[marker]
-			if markerValue > 0 {
-				cMarkers[markerValue] += 1
-			}
+		modal.YstrMarkers[marker] = modalValue(persons, marker, policy)
+	}
+	return &modal
+}
+
+// modalValue calculates the modal value of a single marker for a
+// group of persons. See ModalHaplotypeWith for details.
+func modalValue(persons []*Person, marker int, policy MicroallelePolicy) float64 {
+	// isPreferred returns true if value should be chosen
+	// instead of modalValue if both have the same frequency.
+	isPreferred := func(value, modalValue float64) bool {
+		if policy != MicroalleleFractional && IsMicroallele(value) != IsMicroallele(modalValue) {
+			return !IsMicroallele(value)
+		}
+		return value < modalValue
+	}
+	// cMarkers maps marker values to the count of that value.
+	cMarkers := make(map[float64]int)
+	// Count marker values.
+	for _, person := range persons {
+		markerValue := normalizeAllele(person.YstrMarkers[marker])
+		if markerValue > 0 {
+			cMarkers[markerValue] += 1
 		}
+	}
 
-		// Find modal value.
-		max := 0
-		modalValue := 0.0
-		// Determine the marker with the highest occurence.
-		for value, count := range cMarkers {
-			if count > max {
-				modalValue = value
-				max = count
-			}
+	// Find modal value.
+	max := 0
+	modalValue := 0.0
+	// Determine the marker with the highest occurence.
+	for value, count := range cMarkers {
+		if count > max {
+			modalValue = value
+			max = count
 		}
-		// If two markers have the same frequency choose the lower one.
-		for value, count := range cMarkers {
-			if count == max && value < modalValue {
-				modalValue = value
-			}
+	}
+	// If two markers have the same frequency choose the preferred one.
+	for value, count := range cMarkers {
+		if count == max && isPreferred(value, modalValue) {
+			modalValue = value
 		}
-		modal.YstrMarkers[marker] = modalValue
 	}
-	return &modal
+	return modalValue
 }
 
 // DistanceMatrix is a matrix of genetic distances for a list of persons.
@@ -632,6 +763,54 @@ func ModalHaplotype(persons []*Person) *Person {
 type DistanceMatrix struct {
 	Size   int
 	Values [][]float64
+	// flagged marks distances that are less reliable, for example
+	// because the persons have been compared by too few markers.
+	flagged [][]bool
+}
+
+// Flag marks the distances of pairs of persons as less reliable.
+// Each pair contains the indices of both persons.
+func (dm *DistanceMatrix) Flag(pairs [][2]int) {
+	if dm.flagged == nil {
+		dm.flagged = make([][]bool, dm.Size)
+		for row := range dm.flagged {
+			dm.flagged[row] = make([]bool, dm.Size)
+		}
+	}
+	for _, pair := range pairs {
+		dm.flagged[pair[0]][pair[1]] = true
+		dm.flagged[pair[1]][pair[0]] = true
+	}
+}
+
+// IsFlagged reports whether the distance in row and col has been
+// marked by Flag.
+func (dm *DistanceMatrix) IsFlagged(row, col int) bool {
+	return dm.flagged != nil && dm.flagged[row][col]
+}
+
+// Select returns a new distance matrix that contains only the rows
+// and columns given by indices.
+func (dm *DistanceMatrix) Select(indices []int) *DistanceMatrix {
+	result := new(DistanceMatrix)
+	result.Size = len(indices)
+	result.Values = make([][]float64, result.Size)
+	for i, row := range indices {
+		result.Values[i] = make([]float64, result.Size)
+		for j, col := range indices {
+			result.Values[i][j] = dm.Values[row][col]
+		}
+	}
+	if dm.flagged != nil {
+		result.flagged = make([][]bool, result.Size)
+		for i, row := range indices {
+			result.flagged[i] = make([]bool, result.Size)
+			for j, col := range indices {
+				result.flagged[i][j] = dm.flagged[row][col]
+			}
+		}
+	}
+	return result
 }
 
 // NewDistanceMatrix creates a genetic distance matrix for a list of persons.
@@ -665,6 +844,101 @@ func NewDistanceMatrix(
 	return matrix
 }
 
+// ComparedMatrix contains the number of marker values that have been
+// compared for each pair of persons in a distance matrix.
+// Persons who have tested for different marker sets are compared by
+// only those markers that both have tested for. So a small number
+// indicates that the corresponding genetic distance is less reliable.
+type ComparedMatrix struct {
+	Size   int
+	Values [][]int
+}
+
+// NewComparedMatrix creates a matrix of the number of compared
+// marker values for a list of persons. It is the companion of a
+// distance matrix that has been created by model.Distance.
+// If both matrices are needed, NewDistanceMatrices is faster.
+func NewComparedMatrix(
+	persons []*Person,
+	mutationRates YstrMarkers,
+	model DistanceModel,
+) *ComparedMatrix {
+	_, compared := NewDistanceMatrices(persons, mutationRates, model)
+	return compared
+}
+
+// NewDistanceMatrices creates a genetic distance matrix like
+// NewDistanceMatrix using model.Distance and the companion matrix
+// of the number of compared marker values. Both matrices are
+// calculated in a single pass.
+func NewDistanceMatrices(
+	persons []*Person,
+	mutationRates YstrMarkers,
+	model DistanceModel,
+) (*DistanceMatrix, *ComparedMatrix) {
+	matrix := new(DistanceMatrix)
+	matrix.Size = len(persons)
+	compared := new(ComparedMatrix)
+	compared.Size = len(persons)
+
+	// Allocate space.
+	matrix.Values = make([][]float64, matrix.Size)
+	compared.Values = make([][]int, compared.Size)
+	for line := 0; line < matrix.Size; line++ {
+		matrix.Values[line] = make([]float64, matrix.Size)
+		compared.Values[line] = make([]int, compared.Size)
+	}
+
+	// Calculate the upper right triangle
+	// and copy it to the lower left triangle.
+	distances := make([]float64, MaxMarkers)
+	for i := 0; i < matrix.Size; i++ {
+		for j := i; j < matrix.Size; j++ {
+			markers := markerDistances(persons[i].YstrMarkers, persons[j].YstrMarkers, mutationRates, model)
+			nCompared := 0
+			for k, marker := range markers {
+				distances[k] = marker.Distance
+				nCompared += marker.NCompared
+			}
+			matrix.Values[i][j] = average(distances, nCompared)
+			matrix.Values[j][i] = matrix.Values[i][j]
+			compared.Values[i][j] = nCompared
+			compared.Values[j][i] = nCompared
+		}
+	}
+	return matrix, compared
+}
+
+// Select returns a new compared matrix that contains only the rows
+// and columns given by indices.
+func (cm *ComparedMatrix) Select(indices []int) *ComparedMatrix {
+	result := new(ComparedMatrix)
+	result.Size = len(indices)
+	result.Values = make([][]int, result.Size)
+	for i, row := range indices {
+		result.Values[i] = make([]int, result.Size)
+		for j, col := range indices {
+			result.Values[i][j] = cm.Values[row][col]
+		}
+	}
+	return result
+}
+
+// Below returns all pairs of persons that have been compared
+// by less than minCompared values.
+// Each pair contains the indices of both persons.
+func (cm *ComparedMatrix) Below(minCompared int) [][2]int {
+	result := make([][2]int, 0)
+	for i := 0; i < cm.Size; i++ {
+		for j := i + 1; j < cm.Size; j++ {
+			if cm.Values[i][j] < minCompared {
+				result = append(result, [2]int{i, j})
+			}
+		}
+	}
+	return result
+}
+
 // Years returns a new Distance matrix that contains the distances in years units.
 // The entries are just multiplied by generationDistance and calibrationFactor.
 //
@@ -689,6 +963,7 @@ func (dm *DistanceMatrix) Years(generationDistance, calibrationFactor float64) *
 			result.Values[i][j] = math.Trunc(factor * dm.Values[i][j])
 		}
 	}
+	result.flagged = dm.flagged
 	return result
 }
 
@@ -745,11 +1020,57 @@ func ReduceToMarkerSet(persons []*Person, nMarkers int) ([]*Person, error) {
 	return result, nil
 }
 
+// ReduceToOverlap reduces a slice of persons so that each pair of the
+// remaining persons has been compared by at least minCompared marker values.
+// compared must be the ComparedMatrix for persons.
+// Persons with the most insufficient comparisons are removed first.
+// If the result contains less than two persons this function returns an error.
+func ReduceToOverlap(persons []*Person, compared *ComparedMatrix, minCompared int) ([]*Person, error) {
+	isRemoved := make([]bool, len(persons))
+	for {
+		// Count the insufficient comparisons for each remaining person.
+		counts := make([]int, len(persons))
+		for _, pair := range compared.Below(minCompared) {
+			if !isRemoved[pair[0]] && !isRemoved[pair[1]] {
+				counts[pair[0]]++
+				counts[pair[1]]++
+			}
+		}
+		worst := -1
+		for i, count := range counts {
+			if count > 0 && (worst == -1 || count > counts[worst]) {
+				worst = i
+			}
+		}
+		if worst == -1 {
+			break
+		}
+		isRemoved[worst] = true
+	}
+	result := make([]*Person, 0, len(persons))
+	for i, p := range persons {
+		if !isRemoved[i] {
+			result = append(result, p)
+		}
+	}
+	if len(result) < 2 {
+		return result, errors.New("not enough persons who share so many markers")
+	}
+	return result, nil
+}
+
 // MarkerStatistics represents statistical information about
 // each marker's values and frequencies.
 type MarkerStatistics struct {
 	// NSamples is the total number of Samples.
 	NSamples int
+	// NHaplotypes is the number of different haplotypes.
+	// Haplotypes are compared on the markers that have been
+	// tested by all samples.
+	NHaplotypes int
+	// HaplotypeDiversity is the probability that two randomly
+	// chosen samples have different haplotypes, see Diversity.
+	HaplotypeDiversity float64
 	// Markers holds statistical information for each single marker.
 	Markers [MaxMarkers + NDYS464ext]struct {
 		// FrequencyAmongSamples normed to 1.
@@ -786,9 +1107,38 @@ func NewStatistics(persons []*Person) *MarkerStatistics {
 		}
 		result.Markers[i].FrequencyAmongSamples = nMutations / float64(result.NSamples)
 	}
+	// Count haplotypes. Only markers that have been tested by all
+	// persons are compared, so that persons who have tested for
+	// different numbers of markers can have the same haplotype.
+	haplotypes := make(map[YstrMarkers]int)
+	for _, p := range persons {
+		var haplotype YstrMarkers
+		for i := range haplotype {
+			if result.Markers[i].FrequencyAmongSamples == 1 {
+				haplotype[i] = p.YstrMarkers[i]
+			}
+		}
+		haplotypes[haplotype]++
+	}
+	counts := make([]int, 0, len(haplotypes))
+	for _, count := range haplotypes {
+		counts = append(counts, count)
+	}
+	result.NHaplotypes = len(haplotypes)
+	result.HaplotypeDiversity = Diversity(counts)
 	return &result
 }
 
+// nTested returns the number of samples that have been tested
+// for the marker.
+func (s *MarkerStatistics) nTested(marker int) int {
+	n := 0
+	for _, count := range s.Markers[marker].ValuesOccurrences {
+		n += count
+	}
+	return n
+}
+
 // Select returns a MarkerStatistics where only markers are included,
 // that satisfy the following conditions:
 //
@@ -801,6 +1151,8 @@ func NewStatistics(persons []*Person) *MarkerStatistics {
 func (s *MarkerStatistics) Select(minFrequency float64, nValuesMin, nValuesMax int) *MarkerStatistics {
 	result := MarkerStatistics{}
 	result.NSamples = s.NSamples
+	result.NHaplotypes = s.NHaplotypes
+	result.HaplotypeDiversity = s.HaplotypeDiversity
 	for i, _ := range s.Markers {
 		if s.Markers[i].FrequencyAmongSamples >= minFrequency &&
 			s.Markers[i].ValuesOccurrences != nil &&
@@ -812,6 +1164,18 @@ func (s *MarkerStatistics) Select(minFrequency float64, nValuesMin, nValuesMax i
 	return &result
 }
 
+// Values returns the different values of a marker in ascending order.
+func (s *MarkerStatistics) Values(marker int) []float64 {
+	result := make([]float64, 0, len(s.Markers[marker].ValuesOccurrences))
+	for value := range s.Markers[marker].ValuesOccurrences {
+		result = append(result, value)
+	}
+	sort.Float64s(result)
+	return result
+}
+
+// String returns the statistics of all markers with values.
+// Markers are ordered by their index and values in ascending order.
 func (s *MarkerStatistics) String() string {
 	var buffer bytes.Buffer
 	buffer.WriteString(fmt.Sprintf("Total number of samples: %d\n", s.NSamples))
@@ -819,24 +1183,18 @@ func (s *MarkerStatistics) String() string {
 		if statistics.ValuesOccurrences != nil {
 			// Create output for single marker statistics.
 			name := YstrMarkerTable[marker].InternalName
-			min := 0.0
-			max := 0.0
-			for value, _ := range statistics.ValuesOccurrences {
-				if value > max {
-					max = value
-				}
-				if value < min || min == 0 {
-					min = value
-				}
-			}
-			buffer.WriteString(fmt.Sprintf("%s, Frequency: %.2f, Min: %g, Max: %g, ",
-				name, statistics.FrequencyAmongSamples, min, max))
-			for value, frequency := range statistics.ValuesOccurrences {
-				buffer.WriteString(fmt.Sprintf("%g:%d, ", value, frequency))
+			values := s.Values(marker)
+			min := values[0]
+			max := values[len(values)-1]
+			buffer.WriteString(fmt.Sprintf("%s, Frequency: %.2f, Min: %g, Max: %g, Diversity: %.3f, Variance: %.3f, ",
+				name, statistics.FrequencyAmongSamples, min, max, s.GeneDiversity(marker), s.AlleleVariance(marker)))
+			for _, value := range values {
+				buffer.WriteString(fmt.Sprintf("%g:%d, ", value, statistics.ValuesOccurrences[value]))
 			}
 			buffer.WriteString("\n")
 		}
 	}
+	buffer.WriteString(s.Summary().String() + "\n")
 	return buffer.String()
 }
 
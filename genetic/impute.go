@@ -0,0 +1,212 @@
+package genetic
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// ImputationMethod determines how missing marker values are estimated.
+type ImputationMethod int
+
+const (
+	// ImputeModal fills missing values with the values of the
+	// modal haplotype of the person's group (see Person.Group).
+	// The modal haplotype of all persons is used for persons
+	// without a group and for markers that no member of the
+	// group has tested.
+	ImputeModal ImputationMethod = iota
+	// ImputeNeighbours fills missing values with the modal value
+	// of the genetically nearest persons who have tested for
+	// the marker.
+	ImputeNeighbours
+)
+
+// NewImputationMethod returns the imputation method for a name.
+// Valid names are "modal" and "neighbours".
+func NewImputationMethod(name string) (ImputationMethod, error) {
+	switch name {
+	case "modal":
+		return ImputeModal, nil
+	case "neighbours":
+		return ImputeNeighbours, nil
+	default:
+		return ImputeModal, errors.New("unknown imputation method: " + name)
+	}
+}
+
+// Imputation contains the settings for the estimation of missing
+// marker values.
+type Imputation struct {
+	Method ImputationMethod
+	// NNeighbours is the number of nearest persons that are used
+	// by the ImputeNeighbours method.
+	NNeighbours int
+	// MutationRates and Model are used to find the nearest persons.
+	MutationRates YstrMarkers
+	Model         DistanceModel
+}
+
+// IsImputed reports whether the marker value at index has been imputed.
+func (p *Person) IsImputed(index int) bool {
+	for _, i := range p.Imputed {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// Impute returns a slice of persons, where the missing values of
+// the first nMarkers markers are estimated from the other persons.
+// The indices of the estimated values are stored in the Imputed
+// field of each person. The input persons are not changed.
+// Persons without any marker values are not included in the result.
+//
+// Imputed values are only guesses. They make it possible to include
+// persons who have tested for fewer markers in a tree, but they
+// hide real differences between persons.
+func Impute(persons []*Person, nMarkers int, imputation Imputation) []*Person {
+	if nMarkers > MaxMarkers {
+		nMarkers = MaxMarkers
+	}
+	// Remove persons without values.
+	candidates := make([]*Person, 0, len(persons))
+	for _, p := range persons {
+		if hasValues(p) {
+			candidates = append(candidates, p)
+		}
+	}
+
+	var modal *Person
+	groupModals := make(map[string]*Person)
+	if imputation.Method == ImputeModal {
+		modal = ModalHaplotypeWith(candidates, imputation.Model.Microalleles)
+		members := make(map[string][]*Person)
+		for _, p := range candidates {
+			if p.Group != "" {
+				members[p.Group] = append(members[p.Group], p)
+			}
+		}
+		for group, persons := range members {
+			groupModals[group] = ModalHaplotypeWith(persons, imputation.Model.Microalleles)
+		}
+	}
+
+	result := make([]*Person, len(candidates))
+	for i, p := range candidates {
+		next := new(Person)
+		*next = *p
+		next.Imputed = append([]int(nil), p.Imputed...)
+		var neighbours []*Person
+		// DYS464 is imputed completely if the first value is missing.
+		isMissingDYS464 := next.YstrMarkers[DYS464start] == 0
+		for marker := 0; marker < nMarkers; marker++ {
+			if next.YstrMarkers[marker] > 0 || (!isRequired(marker) && !isMissingDYS464) {
+				continue
+			}
+			value := 0.0
+			switch imputation.Method {
+			case ImputeNeighbours:
+				if neighbours == nil {
+					neighbours = nearest(p, candidates, imputation)
+				}
+				value = neighbourValue(neighbours, marker, imputation)
+			default:
+				if groupModal, exists := groupModals[p.Group]; exists {
+					value = groupModal.YstrMarkers[marker]
+				}
+				if value == 0 {
+					value = modal.YstrMarkers[marker]
+				}
+			}
+			if value > 0 {
+				next.YstrMarkers[marker] = value
+				next.Imputed = append(next.Imputed, marker)
+			}
+		}
+		result[i] = next
+	}
+	return result
+}
+
+// ImputeToMarkerSet reduces the marker set of all persons to the
+// specified number of markers, like ReduceToMarkerSet, but fills
+// missing values by imputation instead of removing persons
+// who have tested for fewer markers.
+// If the result contains less than two persons this function returns an error.
+func ImputeToMarkerSet(persons []*Person, nMarkers int, imputation Imputation) ([]*Person, error) {
+	imputed := Impute(persons, nMarkers, imputation)
+	result := make([]*Person, 0, len(imputed))
+	for _, p := range imputed {
+		next, isComplete := p.markerSet(nMarkers)
+		if isComplete == true {
+			result = append(result, next)
+		}
+	}
+	if len(result) < 2 {
+		return result, errors.New("not enough persons for imputation")
+	}
+	return result, nil
+}
+
+// hasValues reports whether a person has at least one marker value.
+func hasValues(p *Person) bool {
+	for _, value := range p.YstrMarkers {
+		if value > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nearest returns all other persons ordered by their genetic
+// distance to person. Persons who can not be compared are omitted.
+func nearest(person *Person, persons []*Person, imputation Imputation) []*Person {
+	type neighbour struct {
+		person   *Person
+		distance float64
+	}
+	neighbours := make([]neighbour, 0, len(persons))
+	for _, p := range persons {
+		if p == person {
+			continue
+		}
+		d := imputation.Model.Distance(person.YstrMarkers, p.YstrMarkers, imputation.MutationRates)
+		if !math.IsNaN(d) {
+			neighbours = append(neighbours, neighbour{p, d})
+		}
+	}
+	sort.SliceStable(neighbours, func(i, j int) bool {
+		return neighbours[i].distance < neighbours[j].distance
+	})
+	result := make([]*Person, len(neighbours))
+	for i := range neighbours {
+		result[i] = neighbours[i].person
+	}
+	return result
+}
+
+// neighbourValue returns the modal value of a marker among the
+// nearest neighbours who have tested for the marker.
+// Imputed values of neighbours are not used.
+// If no neighbour has a value, 0 is returned.
+func neighbourValue(neighbours []*Person, marker int, imputation Imputation) float64 {
+	n := imputation.NNeighbours
+	if n < 1 {
+		n = 1
+	}
+	donors := make([]*Person, 0, n)
+	for _, p := range neighbours {
+		if p.YstrMarkers[marker] > 0 && !p.IsImputed(marker) {
+			donors = append(donors, p)
+			if len(donors) == n {
+				break
+			}
+		}
+	}
+	if len(donors) == 0 {
+		return 0
+	}
+	return modalValue(donors, marker, imputation.Model.Microalleles)
+}
@@ -0,0 +1,93 @@
+package genetic
+
+import (
+	"errors"
+	"math"
+)
+
+// Microalleles (intermediate alleles) are alleles that contain an
+// incomplete repeat. They are stored as a decimal number where the
+// integer part is the number of complete repeats and the first
+// decimal digit is the number of additional bases.
+// 13.2 means 13 complete repeats and 2 additional bases.
+
+// repeatLength is the assumed number of bases of a single repeat.
+// Most Y-STR markers used for genealogy are tetranucleotide repeats.
+const repeatLength = 4
+
+// MicroallelePolicy determines how the difference between two
+// marker values is scored if at least one of them is a microallele.
+type MicroallelePolicy int
+
+const (
+	// MicroalleleFractional counts an incomplete repeat as a fraction
+	// of a repeat. 13.2 and 14 differ by 0.5 steps.
+	MicroalleleFractional MicroallelePolicy = iota
+	// MicroalleleStep counts the difference of the additional
+	// bases as one step. 13.2 and 14 differ by 2 steps.
+	MicroalleleStep
+	// MicroalleleInfinite counts a microallele that differs from
+	// the other value as one single event, regardless of the
+	// number of repeats. 13.2 and 14 differ by 1.
+	MicroalleleInfinite
+)
+
+// NewMicroallelePolicy returns the microallele policy for a name.
+// Valid names are "fractional", "step" and "infinite".
+func NewMicroallelePolicy(name string) (MicroallelePolicy, error) {
+	switch name {
+	case "fractional":
+		return MicroalleleFractional, nil
+	case "step":
+		return MicroalleleStep, nil
+	case "infinite":
+		return MicroalleleInfinite, nil
+	default:
+		return MicroalleleFractional, errors.New("unknown microallele policy: " + name)
+	}
+}
+
+// Microallele splits a marker value into the number of complete
+// repeats and the number of additional bases.
+func Microallele(value float64) (repeats, bases int) {
+	repeats = int(math.Floor(value))
+	bases = int(math.Round((value - float64(repeats)) * 10))
+	if bases >= 10 {
+		repeats++
+		bases = 0
+	}
+	return repeats, bases
+}
+
+// IsMicroallele reports whether a marker value contains an
+// incomplete repeat.
+func IsMicroallele(value float64) bool {
+	_, bases := Microallele(value)
+	return bases != 0
+}
+
+// normalizeAllele rounds a marker value to one decimal place,
+// so that values from different sources can be compared.
+func normalizeAllele(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// steps calculates the number of mutation steps between two marker
+// values using the given microallele policy.
+func steps(value1, value2 float64, policy MicroallelePolicy) float64 {
+	repeats1, bases1 := Microallele(value1)
+	repeats2, bases2 := Microallele(value2)
+	if bases1 == bases2 {
+		return math.Abs(float64(repeats1 - repeats2))
+	}
+	switch policy {
+	case MicroalleleStep:
+		return math.Abs(float64(repeats1-repeats2)) + 1
+	case MicroalleleInfinite:
+		return 1
+	default:
+		length1 := float64(repeats1) + float64(bases1)/repeatLength
+		length2 := float64(repeats2) + float64(bases2)/repeatLength
+		return math.Abs(length1 - length2)
+	}
+}
@@ -0,0 +1,304 @@
+package genetic
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Network is a haplotype network
+// (https://en.wikipedia.org/wiki/Haplotype_network).
+// For closely related persons networks are often more informative
+// than trees, because they show alternative paths of descent.
+type Network struct {
+	// Markers contains the indices of the markers that have
+	// been used to calculate the network.
+	Markers  []int
+	Vertices []*Vertex
+	Edges    []*Edge
+}
+
+// Vertex is a haplotype in a network.
+type Vertex struct {
+	// Name is H1, H2,... for observed haplotypes and
+	// MV1, MV2,... for median vectors.
+	Name string
+	// Persons contains all persons who share the haplotype.
+	// It is empty for median vectors.
+	Persons []*Person
+	// IsMedian is true for median vectors. Median vectors are
+	// haplotypes that have not been observed but have been
+	// inferred as possible ancestors.
+	IsMedian bool
+	YstrMarkers
+}
+
+// Edge connects two vertices of a network.
+type Edge struct {
+	// From and To are indices into the network's vertices.
+	From int
+	To   int
+	// Distance is the number of mutation steps between the vertices.
+	Distance float64
+	// Mutations contains the markers that differ between the vertices.
+	Mutations []Mutation
+}
+
+// MinimumSpanningNetwork calculates a minimum spanning network
+// (Bandelt et al. 1999), which is the union of all minimum spanning
+// trees of the persons' haplotypes.
+//
+// Only single-copy markers (see IsMultiCopy) that have been tested by
+// all persons are used. The distance between two haplotypes is the number of mutation
+// steps summed over all markers. policy determines how microalleles
+// are scored. Persons with identical haplotypes share a vertex.
+func MinimumSpanningNetwork(persons []*Person, policy MicroallelePolicy) *Network {
+	network := newHaplotypeNetwork(persons)
+	network.connect(policy)
+	return network
+}
+
+// MedianJoiningNetwork calculates a median-joining network
+// (Bandelt, Forster and Röhl 1999, https://doi.org/10.1093/oxfordjournals.molbev.a026036).
+// Starting from the minimum spanning network, median vectors are
+// calculated for all triplets of connected haplotypes. For each marker
+// the median vector contains the median of the three values. In each
+// round the new median vectors with the lowest connection cost, the sum
+// of the distances to the three haplotypes, are added and the network is
+// connected again. Median vectors that connect less than three vertices
+// are removed again. The calculation stops when no new median vectors
+// are found. The parameter epsilon of the original algorithm is 0.
+//
+// The markers and distances are the same as for MinimumSpanningNetwork.
+func MedianJoiningNetwork(persons []*Person, policy MicroallelePolicy) *Network {
+	network := newHaplotypeNetwork(persons)
+	// known contains all haplotypes that have been part of the network.
+	// Median vectors are never added twice, so the calculation terminates.
+	known := make(map[string]bool)
+	for _, v := range network.Vertices {
+		known[network.key(v)] = true
+	}
+	for {
+		network.connect(policy)
+		for network.removeObsoleteMedians() {
+			network.connect(policy)
+		}
+		medians := network.medians(policy)
+		added := false
+		for _, median := range medians {
+			key := network.key(median)
+			if !known[key] {
+				known[key] = true
+				network.Vertices = append(network.Vertices, median)
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	// Name median vectors.
+	count := 0
+	for _, v := range network.Vertices {
+		if v.IsMedian {
+			count++
+			v.Name = "MV" + strconv.Itoa(count)
+		}
+	}
+	return network
+}
+
+// newHaplotypeNetwork creates a network without edges that contains
+// a vertex for each distinct haplotype of persons.
+func newHaplotypeNetwork(persons []*Person) *Network {
+	network := Network{Markers: SingleCopyMarkers(persons, MaxMarkers, true)}
+	haplotypes := make(map[string]*Vertex)
+	for _, p := range persons {
+		key := network.key(&Vertex{YstrMarkers: p.YstrMarkers})
+		vertex, exists := haplotypes[key]
+		if !exists {
+			vertex = &Vertex{
+				Name:        "H" + strconv.Itoa(len(network.Vertices)+1),
+				YstrMarkers: p.YstrMarkers,
+			}
+			haplotypes[key] = vertex
+			network.Vertices = append(network.Vertices, vertex)
+		}
+		vertex.Persons = append(vertex.Persons, p)
+	}
+	return &network
+}
+
+// key returns a string that identifies the haplotype of a vertex
+// with respect to the network's markers.
+func (n *Network) key(v *Vertex) string {
+	buffer := make([]byte, 0, 8*len(n.Markers))
+	for _, marker := range n.Markers {
+		buffer = strconv.AppendFloat(buffer, normalizeAllele(v.YstrMarkers[marker]), 'f', -1, 64)
+		buffer = append(buffer, ' ')
+	}
+	return string(buffer)
+}
+
+// distance returns the number of mutation steps between two vertices.
+func (n *Network) distance(v1, v2 *Vertex, policy MicroallelePolicy) float64 {
+	sum := 0.0
+	for _, marker := range n.Markers {
+		sum += steps(v1.YstrMarkers[marker], v2.YstrMarkers[marker], policy)
+	}
+	return sum
+}
+
+// connect replaces the edges of the network by the edges of the
+// minimum spanning network of all vertices.
+// The algorithm is a modification of Kruskal's algorithm, where all
+// edges of the same length are added if they connect different
+// components of the graph before any of them has been added.
+func (n *Network) connect(policy MicroallelePolicy) {
+	candidates := make([]*Edge, 0)
+	for i := 0; i < len(n.Vertices); i++ {
+		for j := i + 1; j < len(n.Vertices); j++ {
+			candidates = append(candidates, &Edge{From: i, To: j, Distance: n.distance(n.Vertices[i], n.Vertices[j], policy)})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Distance < candidates[b].Distance
+	})
+	// component contains the component number for each vertex.
+	component := make([]int, len(n.Vertices))
+	for i := range component {
+		component[i] = i
+	}
+	n.Edges = make([]*Edge, 0, len(n.Vertices))
+	for start := 0; start < len(candidates); {
+		end := start
+		for end < len(candidates) && candidates[end].Distance == candidates[start].Distance {
+			end++
+		}
+		// Add all edges of the same length between different components.
+		merged := make([]*Edge, 0)
+		for _, e := range candidates[start:end] {
+			if component[e.From] != component[e.To] {
+				e.Mutations = n.mutations(n.Vertices[e.From], n.Vertices[e.To])
+				n.Edges = append(n.Edges, e)
+				merged = append(merged, e)
+			}
+		}
+		// Merge components.
+		for _, e := range merged {
+			from, to := component[e.From], component[e.To]
+			if from == to {
+				continue
+			}
+			for i := range component {
+				if component[i] == to {
+					component[i] = from
+				}
+			}
+		}
+		start = end
+	}
+}
+
+// mutations returns the markers that differ between two vertices.
+func (n *Network) mutations(from, to *Vertex) []Mutation {
+	result := make([]Mutation, 0)
+	for _, marker := range n.Markers {
+		v1 := normalizeAllele(from.YstrMarkers[marker])
+		v2 := normalizeAllele(to.YstrMarkers[marker])
+		if v1 != v2 {
+			result = append(result, Mutation{marker, v1, v2})
+		}
+	}
+	return result
+}
+
+// degrees returns the number of edges for each vertex.
+func (n *Network) degrees() []int {
+	result := make([]int, len(n.Vertices))
+	for _, e := range n.Edges {
+		result[e.From]++
+		result[e.To]++
+	}
+	return result
+}
+
+// removeObsoleteMedians removes all median vectors that are connected
+// to less than three vertices. It reports whether a vertex has been
+// removed. The edges of the network are removed as well.
+func (n *Network) removeObsoleteMedians() bool {
+	degrees := n.degrees()
+	vertices := make([]*Vertex, 0, len(n.Vertices))
+	for i, v := range n.Vertices {
+		if !v.IsMedian || degrees[i] >= 3 {
+			vertices = append(vertices, v)
+		}
+	}
+	if len(vertices) == len(n.Vertices) {
+		return false
+	}
+	n.Vertices = vertices
+	n.Edges = nil
+	return true
+}
+
+// medians returns the median vectors of all triplets of vertices,
+// where at least two pairs are connected by an edge, and whose
+// connection cost is minimal. Median vectors that already
+// exist in the network are not returned.
+func (n *Network) medians(policy MicroallelePolicy) []*Vertex {
+	// Collect the neighbours of each vertex.
+	neighbours := make([][]int, len(n.Vertices))
+	for _, e := range n.Edges {
+		neighbours[e.From] = append(neighbours[e.From], e.To)
+		neighbours[e.To] = append(neighbours[e.To], e.From)
+	}
+	existing := make(map[string]bool)
+	for _, v := range n.Vertices {
+		existing[n.key(v)] = true
+	}
+	result := make([]*Vertex, 0)
+	candidates := make(map[string]bool)
+	minCost := -1.0
+	for center, list := range neighbours {
+		for a := 0; a < len(list); a++ {
+			for b := a + 1; b < len(list); b++ {
+				triplet := [3]*Vertex{n.Vertices[center], n.Vertices[list[a]], n.Vertices[list[b]]}
+				median := n.median(triplet)
+				key := n.key(median)
+				if existing[key] {
+					continue
+				}
+				cost := 0.0
+				for _, v := range triplet {
+					cost += n.distance(median, v, policy)
+				}
+				switch {
+				case minCost < 0 || cost < minCost:
+					minCost = cost
+					result = []*Vertex{median}
+					candidates = map[string]bool{key: true}
+				case cost == minCost && !candidates[key]:
+					result = append(result, median)
+					candidates[key] = true
+				}
+			}
+		}
+	}
+	return result
+}
+
+// median returns the median vector of three vertices.
+// The value of each marker is the median of the three values.
+func (n *Network) median(triplet [3]*Vertex) *Vertex {
+	median := Vertex{IsMedian: true}
+	for _, marker := range n.Markers {
+		values := []float64{
+			triplet[0].YstrMarkers[marker],
+			triplet[1].YstrMarkers[marker],
+			triplet[2].YstrMarkers[marker],
+		}
+		sort.Float64s(values)
+		median.YstrMarkers[marker] = values[1]
+	}
+	return &median
+}
@@ -0,0 +1,113 @@
+package genetic
+
+import (
+	"fmt"
+	"math"
+)
+
+// Outlier is a member of a group who is genetically distant from the
+// other members and may be assigned to the wrong group.
+type Outlier struct {
+	Person *Person
+	// Group is the name of the group the person has been assigned to.
+	Group string
+	// DistanceFromModal is the genetic distance to the modal
+	// haplotype of the group.
+	DistanceFromModal float64
+	// AverageDistance is the average genetic distance to the
+	// other members of the group.
+	AverageDistance float64
+	// ModalScore and AverageScore are the number of standard
+	// deviations by which DistanceFromModal and AverageDistance
+	// exceed the mean values of the group.
+	ModalScore   float64
+	AverageScore float64
+	// NearestGroup is the group with the closest modal haplotype
+	// apart from the own group. NearestDistance is the distance
+	// to its modal haplotype.
+	NearestGroup    string
+	NearestDistance float64
+}
+
+// Outliers finds members of groups whose distance to the modal haplotype
+// of their group, or whose average distance to the other members, exceeds
+// the mean of the group by more than threshold standard deviations.
+// Members who are closer to the modal haplotype of another group than to
+// the modal haplotype of their own group are always reported.
+//
+// Groups with less than three members are not examined, but they are
+// used to determine the nearest group. Groups named "noise" are neither
+// examined nor used as nearest group, because their modal haplotype is
+// not the haplotype of a real group.
+func Outliers(groups []*Cluster, mutationRates YstrMarkers, distance DistanceFunc, threshold float64) []Outlier {
+	result := make([]Outlier, 0)
+	for g, group := range groups {
+		n := len(group.Persons)
+		if n < 3 || group.Name == noiseName {
+			continue
+		}
+		// Calculate distances to the modal haplotype and average
+		// distances to other members.
+		fromModal := make([]float64, n)
+		averages := make([]float64, n)
+		for i, p := range group.Persons {
+			fromModal[i] = distance(group.Modal.YstrMarkers, p.YstrMarkers, mutationRates)
+			sum := 0.0
+			for j, other := range group.Persons {
+				if i != j {
+					sum += distance(p.YstrMarkers, other.YstrMarkers, mutationRates)
+				}
+			}
+			averages[i] = sum / float64(n-1)
+		}
+		mModal, sModal, _ := Average(fromModal)
+		mAverage, sAverage, _ := Average(averages)
+
+		for i, p := range group.Persons {
+			outlier := Outlier{
+				Person:            p,
+				Group:             group.Name,
+				DistanceFromModal: fromModal[i],
+				AverageDistance:   averages[i],
+				ModalScore:        score(fromModal[i], mModal, sModal),
+				AverageScore:      score(averages[i], mAverage, sAverage),
+				NearestDistance:   math.Inf(1),
+			}
+			for h, other := range groups {
+				if h == g || other.Name == noiseName || len(other.Persons) == 0 {
+					continue
+				}
+				d := distance(other.Modal.YstrMarkers, p.YstrMarkers, mutationRates)
+				if d < outlier.NearestDistance {
+					outlier.NearestGroup = other.Name
+					outlier.NearestDistance = d
+				}
+			}
+			if outlier.ModalScore > threshold ||
+				outlier.AverageScore > threshold ||
+				outlier.NearestDistance < outlier.DistanceFromModal {
+				result = append(result, outlier)
+			}
+		}
+	}
+	return result
+}
+
+// score returns the number of standard deviations s by which
+// value exceeds the mean m. If s is 0, score returns 0.
+func score(value, m, s float64) float64 {
+	if s == 0 {
+		return 0
+	}
+	return (value - m) / s
+}
+
+// String returns a one line description of the outlier.
+func (o Outlier) String() string {
+	text := fmt.Sprintf("%s in %s: distance from modal %.2f (%.1f SD), average distance %.2f (%.1f SD)",
+		o.Person.Label, o.Group, o.DistanceFromModal, o.ModalScore, o.AverageDistance, o.AverageScore)
+	if o.NearestGroup != "" {
+		text += fmt.Sprintf(", nearest other group %s: %.2f", o.NearestGroup, o.NearestDistance)
+	}
+	return text
+}
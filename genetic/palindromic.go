@@ -0,0 +1,179 @@
+package genetic
+
+import (
+	"errors"
+	"sort"
+)
+
+// PalindromicMethod determines how the genetic distance of
+// palindromic (multi-copy) markers is calculated.
+type PalindromicMethod int
+
+const (
+	// PalindromicFTDNA uses the same approach as Family Tree DNA.
+	// Each value that has no matching value in the other sample
+	// counts as one mutation. A different number of values counts
+	// as one additional mutation.
+	PalindromicFTDNA PalindromicMethod = iota
+	// PalindromicGenebase compares the values in the reported
+	// order like single markers, using the stepwise mutation model
+	// (http://www.genebase.com/learning/article/46).
+	// Each value that is missing in one sample counts as one mutation.
+	PalindromicGenebase
+	// PalindromicSorted sorts the values of both samples in ascending
+	// order and compares them stepwise like the genebase method.
+	PalindromicSorted
+	// PalindromicIgnore excludes all palindromic markers from
+	// the calculation.
+	PalindromicIgnore
+)
+
+// NewPalindromicMethod returns the method for palindromic markers
+// that belongs to a name.
+// Valid names are "ftdna", "genebase", "sorted" and "ignore".
+func NewPalindromicMethod(name string) (PalindromicMethod, error) {
+	switch name {
+	case "ftdna":
+		return PalindromicFTDNA, nil
+	case "genebase":
+		return PalindromicGenebase, nil
+	case "sorted":
+		return PalindromicSorted, nil
+	case "ignore":
+		return PalindromicIgnore, nil
+	default:
+		return PalindromicFTDNA, errors.New("unknown method for palindromic markers: " + name)
+	}
+}
+
+// distancePalindromic calculates the genetic distance for a palindromic
+// marker using the method of the model.
+// ystr1 and ystr2 contain the palindromic values for each person.
+// Values of 0 are treated as missing.
+func (m DistanceModel) distancePalindromic(ystr1, ystr2 []float64, mutationRate float64) float64 {
+	switch m.Palindromic {
+	case PalindromicGenebase:
+		return distancePalindromicStepwise(ystr1, ystr2, mutationRate, m.Microalleles, false)
+	case PalindromicSorted:
+		return distancePalindromicStepwise(ystr1, ystr2, mutationRate, m.Microalleles, true)
+	case PalindromicIgnore:
+		return 0
+	default:
+		return distancePalindromic(ystr1, ystr2, mutationRate)
+	}
+}
+
+// distancePalindromicStepwise calculates the genetic distance for
+// palindromic markers by comparing the values position by position
+// using the stepwise mutation model.
+// If isSorted is true the values are sorted in ascending order
+// before they are compared.
+// A value that exists only in one sample counts as one mutation.
+func distancePalindromicStepwise(ystr1, ystr2 []float64, mutationRate float64, policy MicroallelePolicy, isSorted bool) float64 {
+	if mutationRate == 0 {
+		return 0
+	}
+	// Create two lists that contain only values > 0.
+	list1 := make([]float64, 0, len(ystr1))
+	for _, value := range ystr1 {
+		if value > 0 {
+			list1 = append(list1, value)
+		}
+	}
+	list2 := make([]float64, 0, len(ystr2))
+	for _, value := range ystr2 {
+		if value > 0 {
+			list2 = append(list2, value)
+		}
+	}
+	if isSorted {
+		sort.Float64s(list1)
+		sort.Float64s(list2)
+	}
+	// Make sure list1 is not longer than list2.
+	if len(list1) > len(list2) {
+		list1, list2 = list2, list1
+	}
+	distance := float64(len(list2) - len(list1))
+	for i := range list1 {
+		distance += steps(list1[i], list2[i], policy)
+	}
+	return distance / mutationRate
+}
+
+// palindromicStart returns the index of the first value of the
+// palindromic marker that ends at index end.
+// If end is not the last index of a palindromic marker,
+// isPalindromic is false.
+// The extra values of DYS464 are not included in the range.
+func palindromicStart(end int) (start int, isPalindromic bool) {
+	switch end {
+	case DYS464end:
+		return DYS464start, true
+	case YCAIIend:
+		return YCAIIstart, true
+	case CDYend:
+		return CDYstart, true
+	case DYF395S1end:
+		return DYF395S1start, true
+	case DYS413end:
+		return DYS413start, true
+	}
+	for _, region := range palindromicRegions {
+		if region[1] == end {
+			return region[0], true
+		}
+	}
+	return end, false
+}
+
+// IsMultiCopy reports whether the value at index belongs to a
+// marker with more than one copy. These are the palindromic markers
+// and DYS385 and DYS459.
+func IsMultiCopy(index int) bool {
+	return IsPalindromic(index) ||
+		(index >= DYS385start && index <= DYS385end) ||
+		(index >= DYS459start && index <= DYS459end)
+}
+
+// SingleCopyMarkers returns the indices of the first nMarkers markers
+// that are not multi-copy markers (see IsMultiCopy) and that have been
+// tested by at least one person. If testedByAll is true, only markers
+// that have been tested by all persons are returned.
+// It is used for network and population analysis, which can not
+// handle multi-copy markers.
+func SingleCopyMarkers(persons []*Person, nMarkers int, testedByAll bool) []int {
+	if nMarkers > MaxMarkers {
+		nMarkers = MaxMarkers
+	}
+	result := make([]int, 0, nMarkers)
+	for marker := 0; marker < nMarkers; marker++ {
+		if IsMultiCopy(marker) {
+			continue
+		}
+		nTested := 0
+		for _, p := range persons {
+			if p.YstrMarkers[marker] > 0 {
+				nTested++
+			}
+		}
+		if nTested > 0 && (!testedByAll || nTested == len(persons)) {
+			result = append(result, marker)
+		}
+	}
+	return result
+}
+
+// IsPalindromic reports whether the value at index belongs to a
+// palindromic (multi-copy) marker. This includes the extra values
+// of DYS464.
+func IsPalindromic(index int) bool {
+	if index >= MaxMarkers {
+		return true
+	}
+	start, isPalindromic := index, false
+	for end := index; end < MaxMarkers && !isPalindromic; end++ {
+		start, isPalindromic = palindromicStart(end)
+	}
+	return isPalindromic && start <= index
+}
@@ -0,0 +1,424 @@
+package genetic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarkerRank contains measures for the information content of a marker.
+// Palindromic markers are treated as a single marker, where the
+// combination of all values is regarded as one allele.
+type MarkerRank struct {
+	// Start and End are the first and the last index of the marker.
+	// They are equal for single-copy markers.
+	Start int
+	End   int
+	// NTested is the number of persons who have tested for the marker.
+	NTested int
+	// Entropy is the Shannon entropy of the marker's alleles in bits.
+	Entropy float64
+	// Variance is the sample variance of the marker's values in
+	// repeats. For palindromic markers the variances of all values
+	// are added.
+	Variance float64
+	// Resolution is the share of pairs of persons, who have both
+	// tested for the marker, that have different alleles. It is the
+	// marker's contribution to the resolution of a tree.
+	Resolution float64
+}
+
+// Name returns the name of the marker.
+func (r MarkerRank) Name() string {
+	return markerName(r.End)
+}
+
+// markerUnits returns the first and the last index of all markers.
+// For single-copy markers both indices are equal. The extra values
+// of DYS464 are not included.
+func markerUnits() [][2]int {
+	units := make([][2]int, 0, MaxMarkers)
+	for end := MaxMarkers - 1; end >= 0; end-- {
+		start, _ := palindromicStart(end)
+		units = append(units, [2]int{start, end})
+		end = start
+	}
+	// Reverse order.
+	for i, j := 0, len(units)-1; i < j; i, j = i+1, j-1 {
+		units[i], units[j] = units[j], units[i]
+	}
+	return units
+}
+
+// allele returns the values of a marker as text.
+// An empty string means that the marker has not been tested.
+func allele(ystr *YstrMarkers, unit [2]int) string {
+	if ystr[unit[0]] <= 0 {
+		return ""
+	}
+	texts := make([]string, 0, unit[1]-unit[0]+1)
+	for i := unit[0]; i <= unit[1]; i++ {
+		texts = append(texts, strconv.FormatFloat(normalizeAllele(ystr[i]), 'f', -1, 64))
+	}
+	return strings.Join(texts, "-")
+}
+
+// RankMarkers calculates the information content of all markers that
+// have been tested by at least two persons. The result is ordered by
+// entropy, starting with the most informative marker.
+func RankMarkers(persons []*Person) []MarkerRank {
+	statistics := NewStatistics(persons)
+	result := make([]MarkerRank, 0)
+	for _, unit := range markerUnits() {
+		alleles := make([]string, 0, len(persons))
+		for _, p := range persons {
+			if a := allele(&p.YstrMarkers, unit); a != "" {
+				alleles = append(alleles, a)
+			}
+		}
+		if len(alleles) < 2 {
+			continue
+		}
+		rank := MarkerRank{Start: unit[0], End: unit[1], NTested: len(alleles)}
+		counts := make(map[string]int)
+		for _, a := range alleles {
+			counts[a]++
+		}
+		n := float64(len(alleles))
+		for _, count := range counts {
+			p := float64(count) / n
+			rank.Entropy -= p * math.Log2(p)
+		}
+		for i := unit[0]; i <= unit[1]; i++ {
+			rank.Variance += statistics.AlleleVariance(i)
+		}
+		different := 0
+		for i := 0; i < len(alleles); i++ {
+			for j := i + 1; j < len(alleles); j++ {
+				if alleles[i] != alleles[j] {
+					different++
+				}
+			}
+		}
+		rank.Resolution = float64(different) / (n * (n - 1) / 2)
+		result = append(result, rank)
+	}
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].Entropy > result[b].Entropy
+	})
+	return result
+}
+
+// MarkerRanksTable returns a table of marker ranks.
+func MarkerRanksTable(ranks []MarkerRank) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%-12s %8s %10s %10s %10s\n", "Marker", "Tested", "Entropy", "Variance", "Resolution"))
+	for _, r := range ranks {
+		buffer.WriteString(fmt.Sprintf("%-12s %8d %10.3f %10.3f %10.3f\n", r.Name(), r.NTested, r.Entropy, r.Variance, r.Resolution))
+	}
+	return buffer.String()
+}
+
+// PanelCriterion determines which markers are chosen for a panel.
+type PanelCriterion int
+
+const (
+	// PanelHaplotypes maximizes the number of distinct haplotypes.
+	PanelHaplotypes PanelCriterion = iota
+	// PanelTree maximizes the agreement of the genetic distances
+	// calculated from the panel with the distances calculated from
+	// all markers. The agreement is the correlation coefficient of
+	// the distances of all pairs of persons. Trees are calculated
+	// from distances, so a high agreement results in similar trees.
+	PanelTree
+)
+
+// NewPanelCriterion returns the panel criterion for a name.
+// Valid names are "haplotypes" and "tree".
+func NewPanelCriterion(name string) (PanelCriterion, error) {
+	switch name {
+	case "haplotypes":
+		return PanelHaplotypes, nil
+	case "tree":
+		return PanelTree, nil
+	default:
+		return PanelHaplotypes, errors.New("unknown panel criterion: " + name)
+	}
+}
+
+// PanelStep is a marker that has been added to a panel.
+type PanelStep struct {
+	MarkerRank
+	// Haplotypes is the number of distinct haplotypes of the panel
+	// after the marker has been added. Missing values match any allele.
+	Haplotypes int
+	// Agreement is the correlation of the panel's genetic distances
+	// with the distances of all markers, see PanelTree.
+	Agreement float64
+}
+
+// SelectPanel chooses a panel of nMarkers markers from all markers
+// that have been tested by at least two persons. Markers are added
+// one after another. Each time the marker that improves the criterion
+// most is chosen (greedy algorithm). If two markers are equally good
+// the other criterion decides, and then the marker with the higher
+// entropy is chosen.
+//
+// mutationRates and model are used to calculate genetic distances.
+// Markers without a mutation rate are not considered.
+func SelectPanel(persons []*Person, nMarkers int, criterion PanelCriterion, mutationRates YstrMarkers, model DistanceModel) []PanelStep {
+	ranks := RankMarkers(persons)
+	candidates := make([]MarkerRank, 0, len(ranks))
+	for _, r := range ranks {
+		if mutationRates[r.End] > 0 {
+			candidates = append(candidates, r)
+		}
+	}
+
+	// The contribution of a marker to the genetic distance of two
+	// persons depends only on their alleles. So each person gets an
+	// allele code for each candidate and the contributions are
+	// calculated once for each combination of alleles.
+	codes := make([][]int, len(candidates))
+	contributions := make([][][]MarkerDistance, len(candidates))
+	for c, r := range candidates {
+		codes[c], contributions[c] = alleleContributions(persons, r, mutationRates, model)
+	}
+
+	// pairs contains all pairs of persons whose genetic distance
+	// can be calculated from all markers.
+	type pair struct {
+		a, b int
+		full float64
+	}
+	pairs := make([]pair, 0)
+	for i := 0; i < len(persons); i++ {
+		for j := i + 1; j < len(persons); j++ {
+			full := model.Distance(persons[i].YstrMarkers, persons[j].YstrMarkers, mutationRates)
+			if math.IsNaN(full) || math.IsInf(full, 0) {
+				continue
+			}
+			pairs = append(pairs, pair{a: i, b: j, full: full})
+		}
+	}
+
+	// The sums of the distances and compared values of the current
+	// panel for each pair of persons.
+	sums := make([]float64, len(pairs))
+	nCompared := make([]int, len(pairs))
+	x := make([]float64, len(pairs))
+	y := make([]float64, len(pairs))
+	for k, p := range pairs {
+		y[k] = p.full
+	}
+	// agreement returns the correlation of the distances of the
+	// current panel plus candidate c with the distances of all
+	// markers. Pairs without compared markers have a distance of 0.
+	agreement := func(c int) float64 {
+		for k, p := range pairs {
+			contribution := contributions[c][codes[c][p.a]][codes[c][p.b]]
+			x[k] = 0
+			if n := nCompared[k] + contribution.NCompared; n > 0 {
+				x[k] = (sums[k] + contribution.Distance) / float64(n)
+			}
+		}
+		return correlation(x, y)
+	}
+
+	// haplotypeIDs numbers the distinct haplotypes of the current panel.
+	haplotypeIDs := make([]int, len(persons))
+	// haplotypes returns the number of distinct haplotypes of the
+	// current panel plus candidate c.
+	haplotypes := func(c int) float64 {
+		_, n := splitHaplotypes(persons, candidates[c], haplotypeIDs, codes[c])
+		return float64(n)
+	}
+
+	// primary is the metric of the criterion, secondary its tie-breaker.
+	primary, secondary := haplotypes, agreement
+	if criterion == PanelTree {
+		primary, secondary = agreement, haplotypes
+	}
+
+	result := make([]PanelStep, 0, nMarkers)
+	isChosen := make([]bool, len(candidates))
+	for len(result) < nMarkers && len(result) < len(candidates) {
+		best := -1
+		bestPrimary, bestSecondary := 0.0, math.NaN()
+		// Candidates are ordered by entropy, so the first of
+		// equally good markers has the highest entropy.
+		// The tie-breaker is only calculated for equally good markers.
+		for c := range candidates {
+			if isChosen[c] {
+				continue
+			}
+			value := primary(c)
+			switch {
+			case best < 0 || value > bestPrimary:
+				best, bestPrimary, bestSecondary = c, value, math.NaN()
+			case value == bestPrimary:
+				if math.IsNaN(bestSecondary) {
+					bestSecondary = secondary(best)
+				}
+				if s := secondary(c); s > bestSecondary {
+					best, bestSecondary = c, s
+				}
+			}
+		}
+		if math.IsNaN(bestSecondary) {
+			bestSecondary = secondary(best)
+		}
+		step := PanelStep{MarkerRank: candidates[best]}
+		if criterion == PanelTree {
+			step.Agreement, step.Haplotypes = bestPrimary, int(bestSecondary)
+		} else {
+			step.Haplotypes, step.Agreement = int(bestPrimary), bestSecondary
+		}
+		result = append(result, step)
+
+		// Add the marker to the panel.
+		isChosen[best] = true
+		for k, p := range pairs {
+			contribution := contributions[best][codes[best][p.a]][codes[best][p.b]]
+			sums[k] += contribution.Distance
+			nCompared[k] += contribution.NCompared
+		}
+		haplotypeIDs, _ = splitHaplotypes(persons, candidates[best], haplotypeIDs, codes[best])
+	}
+	return result
+}
+
+// splitHaplotypes splits the haplotypes given by ids by the alleles
+// codes of the marker given by rank. It returns the new haplotype IDs
+// and the number of haplotypes. Persons who were not tested for the
+// marker match any allele. They are counted with the most frequent
+// allele of their haplotype, so that missing values do not create
+// new haplotypes.
+func splitHaplotypes(persons []*Person, rank MarkerRank, ids, codes []int) (newIDs []int, n int) {
+	isTested := func(p int) bool {
+		return persons[p].YstrMarkers[rank.Start] > 0
+	}
+	// Find the most frequent allele of each haplotype.
+	counts := make(map[[2]int]int)
+	frequent := make(map[int]int)
+	for p := range persons {
+		if !isTested(p) {
+			continue
+		}
+		key := [2]int{ids[p], codes[p]}
+		counts[key]++
+		if best, exists := frequent[ids[p]]; !exists || counts[key] > counts[[2]int{ids[p], best}] {
+			frequent[ids[p]] = codes[p]
+		}
+	}
+	newIDs = make([]int, len(persons))
+	known := make(map[[2]int]int)
+	for p := range persons {
+		key := [2]int{ids[p], codes[p]}
+		if !isTested(p) {
+			// Without tested persons the haplotype stays as it is.
+			key = [2]int{ids[p], -1}
+			if code, exists := frequent[ids[p]]; exists {
+				key[1] = code
+			}
+		}
+		if _, exists := known[key]; !exists {
+			known[key] = len(known)
+		}
+		newIDs[p] = known[key]
+	}
+	return newIDs, len(known)
+}
+
+// alleleContributions assigns an allele code to each person for the
+// marker given by rank. contributions[a][b] contains the contribution
+// of the marker to the genetic distance between persons with the
+// alleles a and b. The alleles include the values that the distance
+// of the marker depends on, DYS389i for DYS389ii and the extra values
+// of DYS464.
+func alleleContributions(persons []*Person, rank MarkerRank, mutationRates YstrMarkers, model DistanceModel) (codes []int, contributions [][]MarkerDistance) {
+	indices := make([]int, 0)
+	for i := rank.Start; i <= rank.End; i++ {
+		indices = append(indices, i)
+	}
+	switch rank.End {
+	case DYS389ii:
+		indices = append(indices, DYS389i)
+	case DYS464end:
+		for i := DYS464extStart; i <= DYS464extEnd; i++ {
+			indices = append(indices, i)
+		}
+	}
+	codes = make([]int, len(persons))
+	representatives := make([]*Person, 0)
+	known := make(map[string]int)
+	for p, person := range persons {
+		texts := make([]string, len(indices))
+		for i, index := range indices {
+			texts[i] = strconv.FormatFloat(person.YstrMarkers[index], 'g', -1, 64)
+		}
+		key := strings.Join(texts, " ")
+		code, exists := known[key]
+		if !exists {
+			code = len(representatives)
+			known[key] = code
+			representatives = append(representatives, person)
+		}
+		codes[p] = code
+	}
+	contributions = make([][]MarkerDistance, len(representatives))
+	for a := range representatives {
+		contributions[a] = make([]MarkerDistance, len(representatives))
+	}
+	for a, person1 := range representatives {
+		for b := a; b < len(representatives); b++ {
+			person2 := representatives[b]
+			markers := model.MarkerDistances(person1.YstrMarkers, person2.YstrMarkers, mutationRates)
+			var contribution MarkerDistance
+			for index := rank.Start; index <= rank.End; index++ {
+				contribution.Distance += markers[index].Distance
+				contribution.NCompared += markers[index].NCompared
+			}
+			contributions[a][b] = contribution
+			contributions[b][a] = contribution
+		}
+	}
+	return codes, contributions
+}
+
+// correlation returns the Pearson correlation coefficient of x and y.
+// If one of them has no variance, the result is 0.
+func correlation(x, y []float64) float64 {
+	n := float64(len(x))
+	if n == 0 {
+		return 0
+	}
+	meanX, meanY := sum(x)/n, sum(y)/n
+	covariance, varianceX, varianceY := 0.0, 0.0, 0.0
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return 0
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
+
+// PanelTable returns a table of the markers of a panel in the order
+// they have been chosen, with the number of distinct haplotypes and
+// the agreement with all markers after each step.
+func PanelTable(steps []PanelStep) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%4s %-12s %10s %10s %10s\n", "", "Marker", "Entropy", "Haplotypes", "Agreement"))
+	for i, s := range steps {
+		buffer.WriteString(fmt.Sprintf("%4d %-12s %10.3f %10d %10.3f\n", i+1, s.Name(), s.Entropy, s.Haplotypes, s.Agreement))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,38 @@
+package genetic
+
+import "testing"
+
+// TestSelectPanelMissingValues checks that persons who were not
+// tested for a marker do not create new haplotypes.
+func TestSelectPanelMissingValues(t *testing.T) {
+	// DYS393 splits the persons into 3 haplotypes. DYS390 has been
+	// tested by 2 persons only. If missing values counted as an
+	// allele of their own, it would split them into 3 haplotypes, too.
+	dys393 := []float64{13, 13, 13, 14, 14, 15}
+	dys390 := []float64{24, 25, 0, 0, 0, 0}
+	persons := make([]*Person, len(dys393))
+	for i := range persons {
+		persons[i] = &Person{Label: string(rune('A' + i))}
+		persons[i].YstrMarkers[0] = dys393[i]
+		persons[i].YstrMarkers[1] = dys390[i]
+	}
+	panel := SelectPanel(persons, 2, PanelHaplotypes, DefaultMutationRates(), DistanceModel{})
+	if len(panel) != 2 {
+		t.Fatalf("got %d markers, want 2", len(panel))
+	}
+	want := []struct {
+		name       string
+		haplotypes int
+	}{
+		{"DYS393", 3},
+		// The untested person with DYS393 = 13 matches
+		// one of the tested persons.
+		{"DYS390", 4},
+	}
+	for i, w := range want {
+		if panel[i].Name() != w.name || panel[i].Haplotypes != w.haplotypes {
+			t.Errorf("step %d: got %s with %d haplotypes, want %s with %d",
+				i+1, panel[i].Name(), panel[i].Haplotypes, w.name, w.haplotypes)
+		}
+	}
+}
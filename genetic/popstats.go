@@ -0,0 +1,346 @@
+package genetic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// PopulationStatistics contains measures for the genetic
+// differentiation between populations.
+//
+// Fst is calculated from allele frequencies like Nei's Gst:
+// Fst = (Ht - Hs) / Ht, where Hs is the average gene diversity
+// within populations and Ht is the gene diversity of all persons,
+// both summed over all markers.
+//
+// Rst is calculated by an analysis of molecular variance (AMOVA,
+// Excoffier et al. 1992), where the distance between two persons
+// is the sum of squared mutation steps over all markers. This is
+// the approach of Arlequin for microsatellite data.
+//
+// The p-values are the share of random permutations of persons among
+// populations that result in a value at least as large as the
+// observed one.
+type PopulationStatistics struct {
+	// Populations contains the names of the populations.
+	Populations []string
+	// NPersons contains the number of persons in each population.
+	NPersons []int
+	// Markers contains the indices of the markers that are used.
+	Markers       []int
+	NPermutations int
+	Fst           float64
+	FstP          float64
+	// AMOVA contains the analysis of molecular variance,
+	// where PhiST is Rst.
+	AMOVA AMOVA
+	// PairwiseFst and PairwiseRst contain the values for
+	// each pair of populations. PairwiseFstP and PairwiseRstP
+	// contain the p-values.
+	PairwiseFst  [][]float64
+	PairwiseFstP [][]float64
+	PairwiseRst  [][]float64
+	PairwiseRstP [][]float64
+}
+
+// AMOVA contains the results of an analysis of molecular variance.
+type AMOVA struct {
+	DFAmong  int
+	DFWithin int
+	// SSDAmong and SSDWithin are the sums of squared deviations
+	// among and within populations.
+	SSDAmong  float64
+	SSDWithin float64
+	// VarianceAmong and VarianceWithin are the variance components.
+	VarianceAmong  float64
+	VarianceWithin float64
+	// PhiST is the share of the variance among populations.
+	PhiST float64
+	// P is the p-value of PhiST.
+	P float64
+}
+
+// populationData contains the persons of all populations and the
+// data that is needed for calculations with permuted populations.
+type populationData struct {
+	persons []*Person
+	markers []int
+	// squared contains the sum of squared mutation steps
+	// for each pair of persons.
+	squared [][]float64
+}
+
+// NewPopulationStatistics calculates Fst, Rst and an AMOVA for
+// populations of persons. Clusters named "noise" are ignored.
+//
+// Only single-copy markers that have been tested by all persons are
+// used (see SingleCopyMarkers). For DYS389ii the value of DYS389i is subtracted. policy
+// determines how the steps between microalleles are counted.
+// nPermutations is the number of random permutations for the
+// p-values. The permutations always start with the same seed, so
+// the results are reproducible.
+func NewPopulationStatistics(populations []*Cluster, nPermutations int, policy MicroallelePolicy) (*PopulationStatistics, error) {
+	result := PopulationStatistics{NPermutations: nPermutations}
+	data := populationData{}
+	assignment := make([]int, 0)
+	for _, population := range populations {
+		if population.Name == noiseName || len(population.Persons) == 0 {
+			continue
+		}
+		for _, p := range population.Persons {
+			data.persons = append(data.persons, p)
+			assignment = append(assignment, len(result.Populations))
+		}
+		result.Populations = append(result.Populations, population.Name)
+		result.NPersons = append(result.NPersons, len(population.Persons))
+	}
+	if len(result.Populations) < 2 {
+		return nil, errors.New("at least two populations are needed")
+	}
+
+	// Determine markers.
+	data.markers = SingleCopyMarkers(data.persons, MaxMarkers, true)
+	if len(data.markers) == 0 {
+		return nil, errors.New("no markers that have been tested by all persons")
+	}
+	result.Markers = data.markers
+
+	// Calculate squared distances.
+	value := func(p *Person, marker int) float64 {
+		if marker == DYS389ii && p.YstrMarkers[DYS389i] > 0 {
+			return p.YstrMarkers[DYS389ii] - p.YstrMarkers[DYS389i]
+		}
+		return p.YstrMarkers[marker]
+	}
+	n := len(data.persons)
+	data.squared = make([][]float64, n)
+	for i := range data.squared {
+		data.squared[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			sum := 0.0
+			for _, marker := range data.markers {
+				s := steps(value(data.persons[i], marker), value(data.persons[j], marker), policy)
+				sum += s * s
+			}
+			data.squared[i][j] = sum
+			data.squared[j][i] = sum
+		}
+	}
+
+	// Global values.
+	rng := rand.New(rand.NewSource(1))
+	members := make([]int, n)
+	for i := range members {
+		members[i] = i
+	}
+	nPopulations := len(result.Populations)
+	result.Fst = data.fst(members, assignment, nPopulations)
+	result.FstP = permutationTest(result.Fst, assignment, nPermutations, rng, func(a []int) float64 {
+		return data.fst(members, a, nPopulations)
+	})
+	result.AMOVA = data.amova(members, assignment, nPopulations)
+	result.AMOVA.P = permutationTest(result.AMOVA.PhiST, assignment, nPermutations, rng, func(a []int) float64 {
+		return data.amova(members, a, nPopulations).PhiST
+	})
+
+	// Pairwise values.
+	result.PairwiseFst = newSquareMatrix(nPopulations)
+	result.PairwiseFstP = newSquareMatrix(nPopulations)
+	result.PairwiseRst = newSquareMatrix(nPopulations)
+	result.PairwiseRstP = newSquareMatrix(nPopulations)
+	for a := 0; a < nPopulations; a++ {
+		for b := a + 1; b < nPopulations; b++ {
+			pairMembers := make([]int, 0)
+			pairAssignment := make([]int, 0)
+			for i, population := range assignment {
+				switch population {
+				case a:
+					pairMembers = append(pairMembers, i)
+					pairAssignment = append(pairAssignment, 0)
+				case b:
+					pairMembers = append(pairMembers, i)
+					pairAssignment = append(pairAssignment, 1)
+				}
+			}
+			fst := data.fst(pairMembers, pairAssignment, 2)
+			fstP := permutationTest(fst, pairAssignment, nPermutations, rng, func(assign []int) float64 {
+				return data.fst(pairMembers, assign, 2)
+			})
+			rst := data.amova(pairMembers, pairAssignment, 2).PhiST
+			rstP := permutationTest(rst, pairAssignment, nPermutations, rng, func(assign []int) float64 {
+				return data.amova(pairMembers, assign, 2).PhiST
+			})
+			result.PairwiseFst[a][b], result.PairwiseFst[b][a] = fst, fst
+			result.PairwiseFstP[a][b], result.PairwiseFstP[b][a] = fstP, fstP
+			result.PairwiseRst[a][b], result.PairwiseRst[b][a] = rst, rst
+			result.PairwiseRstP[a][b], result.PairwiseRstP[b][a] = rstP, rstP
+		}
+	}
+	return &result, nil
+}
+
+// fst calculates Fst for the persons with the indices members.
+// assignment contains the population number of each member.
+func (d *populationData) fst(members, assignment []int, nPopulations int) float64 {
+	groups := make([][]*Person, nPopulations)
+	all := make([]*Person, len(members))
+	for i, member := range members {
+		groups[assignment[i]] = append(groups[assignment[i]], d.persons[member])
+		all[i] = d.persons[member]
+	}
+	statistics := make([]*MarkerStatistics, nPopulations)
+	for i, group := range groups {
+		statistics[i] = NewStatistics(group)
+	}
+	allStatistics := NewStatistics(all)
+	sumHt, sumDifference := 0.0, 0.0
+	for _, marker := range d.markers {
+		ht := allStatistics.GeneDiversity(marker)
+		hs, count := 0.0, 0
+		for _, s := range statistics {
+			if s.NSamples > 1 {
+				hs += s.GeneDiversity(marker)
+				count++
+			}
+		}
+		if count > 0 {
+			hs /= float64(count)
+		}
+		sumHt += ht
+		sumDifference += ht - hs
+	}
+	if sumHt == 0 {
+		return 0
+	}
+	return sumDifference / sumHt
+}
+
+// amova calculates an analysis of molecular variance for the persons
+// with the indices members. assignment contains the population number
+// of each member. The p-value is not calculated.
+func (d *populationData) amova(members, assignment []int, nPopulations int) AMOVA {
+	n := len(members)
+	sizes := make([]float64, nPopulations)
+	for _, population := range assignment {
+		sizes[population]++
+	}
+	total := 0.0
+	within := make([]float64, nPopulations)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			squared := d.squared[members[i]][members[j]]
+			total += squared
+			if assignment[i] == assignment[j] {
+				within[assignment[i]] += squared
+			}
+		}
+	}
+	result := AMOVA{
+		DFAmong:  nPopulations - 1,
+		DFWithin: n - nPopulations,
+	}
+	ssdTotal := total / float64(n)
+	sumSquares := 0.0
+	for p, size := range sizes {
+		if size > 0 {
+			result.SSDWithin += within[p] / size
+		}
+		sumSquares += size * size
+	}
+	result.SSDAmong = ssdTotal - result.SSDWithin
+	if result.DFWithin > 0 {
+		result.VarianceWithin = result.SSDWithin / float64(result.DFWithin)
+	}
+	if result.DFAmong > 0 {
+		n0 := (float64(n) - sumSquares/float64(n)) / float64(result.DFAmong)
+		result.VarianceAmong = (result.SSDAmong/float64(result.DFAmong) - result.VarianceWithin) / n0
+	}
+	if variance := result.VarianceAmong + result.VarianceWithin; variance > 0 {
+		result.PhiST = result.VarianceAmong / variance
+	}
+	return result
+}
+
+// permutationTest returns the share of random permutations of
+// assignment for which statistic is at least as large as observed.
+// The observed value itself counts as one permutation.
+func permutationTest(observed float64, assignment []int, nPermutations int, rng *rand.Rand, statistic func([]int) float64) float64 {
+	if nPermutations < 1 {
+		return math.NaN()
+	}
+	permuted := append([]int(nil), assignment...)
+	count := 1
+	for i := 0; i < nPermutations; i++ {
+		rng.Shuffle(len(permuted), func(a, b int) {
+			permuted[a], permuted[b] = permuted[b], permuted[a]
+		})
+		// Allow for rounding errors.
+		if statistic(permuted) >= observed-1e-12 {
+			count++
+		}
+	}
+	return float64(count) / float64(nPermutations+1)
+}
+
+// newSquareMatrix returns a size x size matrix filled with zeros.
+func newSquareMatrix(size int) [][]float64 {
+	result := make([][]float64, size)
+	for i := range result {
+		result[i] = make([]float64, size)
+	}
+	return result
+}
+
+// String returns a report of the population statistics.
+func (s *PopulationStatistics) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Population statistics for %d populations using %d markers and %d permutations\n",
+		len(s.Populations), len(s.Markers), s.NPermutations))
+	for i, name := range s.Populations {
+		buffer.WriteString(fmt.Sprintf("%-20s %4d persons\n", name, s.NPersons[i]))
+	}
+	buffer.WriteString(fmt.Sprintf("\nFst: %.4f (p = %.4f)\n", s.Fst, s.FstP))
+	buffer.WriteString(fmt.Sprintf("Rst: %.4f (p = %.4f)\n", s.AMOVA.PhiST, s.AMOVA.P))
+
+	a := s.AMOVA
+	total := a.VarianceAmong + a.VarianceWithin
+	percentage := func(variance float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * variance / total
+	}
+	buffer.WriteString("\nAMOVA (sum of squared mutation steps)\n")
+	buffer.WriteString(fmt.Sprintf("%-20s %6s %12s %12s %10s\n", "Source", "d.f.", "SSD", "Variance", "%"))
+	buffer.WriteString(fmt.Sprintf("%-20s %6d %12.3f %12.3f %10.2f\n", "Among populations", a.DFAmong, a.SSDAmong, a.VarianceAmong, percentage(a.VarianceAmong)))
+	buffer.WriteString(fmt.Sprintf("%-20s %6d %12.3f %12.3f %10.2f\n", "Within populations", a.DFWithin, a.SSDWithin, a.VarianceWithin, percentage(a.VarianceWithin)))
+	buffer.WriteString(fmt.Sprintf("%-20s %6d %12.3f %12.3f %10.2f\n", "Total", a.DFAmong+a.DFWithin, a.SSDAmong+a.SSDWithin, total, 100.0))
+
+	matrix := func(title string, values, p [][]float64) {
+		buffer.WriteString("\n" + title + " (p-values in parentheses)\n")
+		buffer.WriteString(fmt.Sprintf("%-20s", ""))
+		for _, name := range s.Populations {
+			buffer.WriteString(fmt.Sprintf(" %18s", name))
+		}
+		buffer.WriteString("\n")
+		for i, name := range s.Populations {
+			buffer.WriteString(fmt.Sprintf("%-20s", name))
+			for j := range s.Populations {
+				if i == j {
+					buffer.WriteString(fmt.Sprintf(" %18s", "-"))
+				} else {
+					buffer.WriteString(fmt.Sprintf(" %18s", fmt.Sprintf("%.4f (%.4f)", values[i][j], p[i][j])))
+				}
+			}
+			buffer.WriteString("\n")
+		}
+	}
+	matrix("Pairwise Fst", s.PairwiseFst, s.PairwiseFstP)
+	matrix("Pairwise Rst", s.PairwiseRst, s.PairwiseRstP)
+	return buffer.String()
+}
@@ -0,0 +1,313 @@
+package genetic
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// defaultMinFrequency is the frequency that is used for allele values
+// that do not occur in the reference data of a haplogroup.
+const defaultMinFrequency = 0.001
+
+// HaplogroupModel is a reference model for the prediction of
+// haplogroups from Y-STR values. It contains the allele frequencies
+// for each marker and haplogroup.
+// The prediction works like the predictors of Whit Athey and Nevgen,
+// using a naive Bayesian classifier.
+type HaplogroupModel struct {
+	// MinFrequency is used for allele values that do not occur
+	// in the reference data of a haplogroup.
+	// If it is 0 a default value is used.
+	MinFrequency float64
+	Haplogroups  []*HaplogroupFrequencies
+}
+
+// HaplogroupFrequencies contains the allele frequencies for
+// a single haplogroup.
+type HaplogroupFrequencies struct {
+	Name string
+	// Prior is the prior probability of the haplogroup.
+	// If all priors are 0, all haplogroups are assumed to be
+	// equally likely.
+	Prior float64
+	// Frequencies maps marker indices to a map of
+	// allele values and their frequencies.
+	Frequencies map[int]map[float64]float64
+}
+
+// Prediction is the probability that a person belongs to a haplogroup.
+type Prediction struct {
+	Haplogroup  string
+	Probability float64
+}
+
+// Predict calculates the probability for each haplogroup of the model
+// for a set of Y-STR markers. The result is ordered by probability,
+// starting with the most likely haplogroup.
+// All haplogroups are compared on the same markers: the markers that
+// are part of the reference data of any haplogroup. Values that do not
+// occur in a haplogroup's reference data, including values of markers
+// that the haplogroup lacks, are given the model's MinFrequency.
+// Markers without values are ignored.
+func (m *HaplogroupModel) Predict(ystr YstrMarkers) []Prediction {
+	minFrequency := m.MinFrequency
+	if minFrequency <= 0 {
+		minFrequency = defaultMinFrequency
+	}
+	usePriors := false
+	for _, h := range m.Haplogroups {
+		if h.Prior > 0 {
+			usePriors = true
+		}
+	}
+	// Collect the markers of all haplogroups.
+	markers := make([]int, 0)
+	isIncluded := make(map[int]bool)
+	for _, h := range m.Haplogroups {
+		for marker := range h.Frequencies {
+			if !isIncluded[marker] {
+				isIncluded[marker] = true
+				markers = append(markers, marker)
+			}
+		}
+	}
+	sort.Ints(markers)
+	// Calculate log likelihoods for each haplogroup.
+	logs := make([]float64, len(m.Haplogroups))
+	for i, h := range m.Haplogroups {
+		if usePriors {
+			logs[i] = math.Log(math.Max(h.Prior, minFrequency))
+		}
+		for _, marker := range markers {
+			value := normalizeAllele(ystr[marker])
+			if value <= 0 {
+				continue
+			}
+			frequency := h.Frequencies[marker][value]
+			if frequency < minFrequency {
+				frequency = minFrequency
+			}
+			logs[i] += math.Log(frequency)
+		}
+	}
+	// Normalize so that all probabilities sum up to 1.
+	max := math.Inf(-1)
+	for _, l := range logs {
+		max = math.Max(max, l)
+	}
+	total := 0.0
+	for _, l := range logs {
+		total += math.Exp(l - max)
+	}
+	result := make([]Prediction, len(m.Haplogroups))
+	for i, h := range m.Haplogroups {
+		result[i] = Prediction{
+			Haplogroup:  h.Name,
+			Probability: math.Exp(logs[i]-max) / total,
+		}
+	}
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].Probability > result[b].Probability
+	})
+	return result
+}
+
+// TrainHaplogroupModel creates a haplogroup model from persons whose
+// haplogroup is known. The haplogroup is taken from the person's Group
+// field. Persons without a group are ignored.
+//
+// The allele frequencies are estimated by counting with additive
+// smoothing: f = (count + smoothing) / (n + smoothing * k), where
+// n is the number of group members who have tested for the marker and
+// k is the number of different values of the marker among all persons.
+// Only markers that have been tested by members of all haplogroups are
+// included in the model. The prior of each haplogroup is its share of
+// all persons.
+func TrainHaplogroupModel(persons []*Person, smoothing float64) *HaplogroupModel {
+	// Group persons by haplogroup.
+	names := make([]string, 0)
+	groups := make(map[string][]*Person)
+	all := make([]*Person, 0, len(persons))
+	for _, p := range persons {
+		if p.Group == "" {
+			continue
+		}
+		if _, exists := groups[p.Group]; !exists {
+			names = append(names, p.Group)
+		}
+		groups[p.Group] = append(groups[p.Group], p)
+		all = append(all, p)
+	}
+	model := HaplogroupModel{
+		MinFrequency: defaultMinFrequency,
+		Haplogroups:  make([]*HaplogroupFrequencies, 0, len(names)),
+	}
+	if len(all) == 0 {
+		return &model
+	}
+	if smoothing > 0 {
+		model.MinFrequency = smoothing / (float64(len(all)) + smoothing)
+	}
+
+	// Determine the markers that are tested in all groups.
+	allStatistics := NewStatistics(all)
+	statistics := make(map[string]*MarkerStatistics)
+	for _, name := range names {
+		statistics[name] = NewStatistics(groups[name])
+	}
+	markers := make([]int, 0, MaxMarkers)
+	for marker := 0; marker < MaxMarkers; marker++ {
+		isTested := true
+		for _, name := range names {
+			if statistics[name].nTested(marker) == 0 {
+				isTested = false
+				break
+			}
+		}
+		if isTested {
+			markers = append(markers, marker)
+		}
+	}
+
+	// Count allele frequencies.
+	for _, name := range names {
+		haplogroup := HaplogroupFrequencies{
+			Name:        name,
+			Prior:       float64(len(groups[name])) / float64(len(all)),
+			Frequencies: make(map[int]map[float64]float64),
+		}
+		for _, marker := range markers {
+			counts := make(map[float64]int)
+			for value, count := range statistics[name].Markers[marker].ValuesOccurrences {
+				counts[normalizeAllele(value)] += count
+			}
+			values := make(map[float64]bool)
+			for value := range allStatistics.Markers[marker].ValuesOccurrences {
+				values[normalizeAllele(value)] = true
+			}
+			n := float64(statistics[name].nTested(marker))
+			k := float64(len(values))
+			frequencies := make(map[float64]float64)
+			for value := range values {
+				frequencies[value] = (float64(counts[value]) + smoothing) / (n + smoothing*k)
+			}
+			haplogroup.Frequencies[marker] = frequencies
+		}
+		model.Haplogroups = append(model.Haplogroups, &haplogroup)
+	}
+	return &model
+}
+
+// CrossValidation contains the results of a cross validation
+// of haplogroup predictions.
+type CrossValidation struct {
+	NFolds int
+	// Haplogroups contains the names of all haplogroups
+	// in order of their first appearance.
+	Haplogroups []string
+	// NPersons maps haplogroups to the number of tested persons.
+	NPersons map[string]int
+	// NCorrect maps haplogroups to the number of persons whose
+	// haplogroup has been predicted correctly.
+	NCorrect map[string]int
+	// Confusion maps a haplogroup to the predicted haplogroups
+	// and their number of occurrences.
+	Confusion map[string]map[string]int
+}
+
+// CrossValidate estimates the accuracy of haplogroup predictions by
+// k-fold cross validation. The persons are split into nFolds parts.
+// Each part is predicted by a model that has been trained with the
+// other parts. Persons without a group are ignored.
+func CrossValidate(persons []*Person, nFolds int, smoothing float64) *CrossValidation {
+	result := CrossValidation{
+		NFolds:    nFolds,
+		NPersons:  make(map[string]int),
+		NCorrect:  make(map[string]int),
+		Confusion: make(map[string]map[string]int),
+	}
+	labeled := make([]*Person, 0, len(persons))
+	for _, p := range persons {
+		if p.Group != "" {
+			labeled = append(labeled, p)
+			if _, exists := result.Confusion[p.Group]; !exists {
+				result.Haplogroups = append(result.Haplogroups, p.Group)
+				result.Confusion[p.Group] = make(map[string]int)
+			}
+		}
+	}
+	if nFolds < 2 {
+		return &result
+	}
+	for fold := 0; fold < nFolds; fold++ {
+		training := make([]*Person, 0, len(labeled))
+		test := make([]*Person, 0, len(labeled)/nFolds+1)
+		for i, p := range labeled {
+			if i%nFolds == fold {
+				test = append(test, p)
+			} else {
+				training = append(training, p)
+			}
+		}
+		model := TrainHaplogroupModel(training, smoothing)
+		for _, p := range test {
+			predictions := model.Predict(p.YstrMarkers)
+			predicted := ""
+			if len(predictions) > 0 {
+				predicted = predictions[0].Haplogroup
+			}
+			result.NPersons[p.Group]++
+			result.Confusion[p.Group][predicted]++
+			if predicted == p.Group {
+				result.NCorrect[p.Group]++
+			}
+		}
+	}
+	return &result
+}
+
+// Accuracy returns the share of all persons whose haplogroup
+// has been predicted correctly.
+func (c *CrossValidation) Accuracy() float64 {
+	n, correct := 0, 0
+	for _, name := range c.Haplogroups {
+		n += c.NPersons[name]
+		correct += c.NCorrect[name]
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(correct) / float64(n)
+}
+
+// String returns a report of the cross validation.
+func (c *CrossValidation) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Cross validation with %d folds, accuracy: %.1f%%\n", c.NFolds, 100*c.Accuracy()))
+	for _, name := range c.Haplogroups {
+		n := c.NPersons[name]
+		accuracy := 0.0
+		if n > 0 {
+			accuracy = float64(c.NCorrect[name]) / float64(n)
+		}
+		buffer.WriteString(fmt.Sprintf("%s: %d of %d correct (%.1f%%)", name, c.NCorrect[name], n, 100*accuracy))
+		// List wrong predictions.
+		wrong := make([]string, 0)
+		for predicted := range c.Confusion[name] {
+			if predicted != name {
+				wrong = append(wrong, predicted)
+			}
+		}
+		sort.Strings(wrong)
+		for i, predicted := range wrong {
+			if i == 0 {
+				buffer.WriteString(", predicted as")
+			}
+			buffer.WriteString(fmt.Sprintf(" %s: %d", predicted, c.Confusion[name][predicted]))
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,107 @@
+package genetic
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// SignatureValue is a marker value that distinguishes a group of
+// persons from all other persons.
+type SignatureValue struct {
+	// Marker is the index of the marker.
+	Marker int
+	Value  float64
+	// FrequencyInGroup is the share of group members who have
+	// this value, among all members who have tested for the marker.
+	FrequencyInGroup float64
+	// FrequencyOutside is the share of other persons who have
+	// this value, among all other persons who have tested for the marker.
+	FrequencyOutside float64
+}
+
+// Signature contains the marker values that are characteristic
+// for a group of persons.
+type Signature struct {
+	Group    string
+	NPersons int
+	Values   []SignatureValue
+}
+
+// Signatures finds the signature (diagnostic) marker values for each
+// cluster. A value belongs to the signature of a cluster if it occurs
+// at least at a frequency of minInGroup among the members, and at most
+// at a frequency of maxOutside among all other persons.
+// The values of each signature are ordered by how well they
+// distinguish the cluster from others.
+//
+// Clusters named "noise" are skipped.
+func Signatures(clusters []*Cluster, minInGroup, maxOutside float64) []*Signature {
+	result := make([]*Signature, 0, len(clusters))
+	for i, cluster := range clusters {
+		if cluster.Name == noiseName {
+			continue
+		}
+		outside := make([]*Person, 0)
+		for j, other := range clusters {
+			if j != i {
+				outside = append(outside, other.Persons...)
+			}
+		}
+		inStatistics := NewStatistics(cluster.Persons)
+		outStatistics := NewStatistics(outside)
+
+		signature := Signature{
+			Group:    cluster.Name,
+			NPersons: len(cluster.Persons),
+			Values:   make([]SignatureValue, 0),
+		}
+		for marker := 0; marker < MaxMarkers; marker++ {
+			nIn := inStatistics.nTested(marker)
+			nOut := outStatistics.nTested(marker)
+			for value, count := range inStatistics.Markers[marker].ValuesOccurrences {
+				inGroup := float64(count) / float64(nIn)
+				outsideGroup := 0.0
+				if nOut > 0 {
+					outsideGroup = float64(outStatistics.Markers[marker].ValuesOccurrences[value]) / float64(nOut)
+				}
+				if inGroup >= minInGroup && outsideGroup <= maxOutside {
+					signature.Values = append(signature.Values, SignatureValue{
+						Marker:           marker,
+						Value:            value,
+						FrequencyInGroup: inGroup,
+						FrequencyOutside: outsideGroup,
+					})
+				}
+			}
+		}
+		sort.SliceStable(signature.Values, func(a, b int) bool {
+			va, vb := signature.Values[a], signature.Values[b]
+			da := va.FrequencyInGroup - va.FrequencyOutside
+			db := vb.FrequencyInGroup - vb.FrequencyOutside
+			if da != db {
+				return da > db
+			}
+			if va.Marker != vb.Marker {
+				return va.Marker < vb.Marker
+			}
+			return va.Value < vb.Value
+		})
+		result = append(result, &signature)
+	}
+	return result
+}
+
+// String returns the signature in human readable form.
+func (s *Signature) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Signature of %s, %d persons\n", s.Group, s.NPersons))
+	if len(s.Values) == 0 {
+		buffer.WriteString("No signature values found.\n")
+	}
+	for _, v := range s.Values {
+		buffer.WriteString(fmt.Sprintf("%s=%g, in group: %.2f, outside: %.2f\n",
+			YstrMarkerTable[v.Marker].InternalName, v.Value, v.FrequencyInGroup, v.FrequencyOutside))
+	}
+	return buffer.String()
+}
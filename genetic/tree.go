@@ -0,0 +1,258 @@
+package genetic
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Node is a node of a phylogenetic tree.
+// Leaves usually represent persons. Internal nodes represent
+// common ancestors.
+type Node struct {
+	// Name is the label of a leaf or the name of an internal node.
+	Name string
+	// Length is the length of the branch to the parent node.
+	Length float64
+	// Person is the person that belongs to a leaf.
+	// It is nil for internal nodes and unknown leaves.
+	Person   *Person
+	Parent   *Node
+	Children []*Node
+	// YstrMarkers contains the values of a leaf's person or
+	// the reconstructed values of an ancestor.
+	YstrMarkers
+}
+
+// IsLeaf reports whether the node has no children.
+func (n *Node) IsLeaf() bool {
+	return len(n.Children) == 0
+}
+
+// AddChild appends child to the children of n.
+func (n *Node) AddChild(child *Node) {
+	child.Parent = n
+	n.Children = append(n.Children, child)
+}
+
+// Nodes returns all nodes of the tree below and including n
+// in preorder.
+func (n *Node) Nodes() []*Node {
+	result := []*Node{n}
+	for _, child := range n.Children {
+		result = append(result, child.Nodes()...)
+	}
+	return result
+}
+
+// Leaves returns all leaves of the tree below and including n.
+func (n *Node) Leaves() []*Node {
+	result := make([]*Node, 0)
+	for _, node := range n.Nodes() {
+		if node.IsLeaf() {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// NameInternalNodes gives all internal nodes without a name
+// the names N1, N2,... in preorder.
+func (n *Node) NameInternalNodes() {
+	count := 0
+	for _, node := range n.Nodes() {
+		if !node.IsLeaf() {
+			count++
+			if node.Name == "" {
+				node.Name = "N" + strconv.Itoa(count)
+			}
+		}
+	}
+}
+
+// NewUPGMATree creates a rooted phylogenetic tree from a distance
+// matrix using the UPGMA method
+// (https://en.wikipedia.org/wiki/UPGMA).
+// dm must be the distance matrix for persons.
+// The leaves are named by the persons' labels.
+// If dm is empty the result is nil.
+func NewUPGMATree(persons []*Person, dm *DistanceMatrix) *Node {
+	if dm.Size == 0 {
+		return nil
+	}
+	type cluster struct {
+		node    *Node
+		members []int
+		height  float64
+	}
+	clusters := make([]*cluster, dm.Size)
+	for i := range clusters {
+		leaf := &Node{Name: persons[i].Label, Person: persons[i], YstrMarkers: persons[i].YstrMarkers}
+		clusters[i] = &cluster{node: leaf, members: []int{i}}
+	}
+	// linkage returns the average distance between two clusters.
+	linkage := func(a, b *cluster) float64 {
+		sum := 0.0
+		for _, i := range a.members {
+			for _, j := range b.members {
+				sum += dm.Values[i][j]
+			}
+		}
+		return sum / float64(len(a.members)*len(b.members))
+	}
+	for len(clusters) > 1 {
+		// Find the nearest pair of clusters.
+		best := math.Inf(1)
+		bestA, bestB := 0, 1
+		for a := 0; a < len(clusters); a++ {
+			for b := a + 1; b < len(clusters); b++ {
+				if d := linkage(clusters[a], clusters[b]); d < best {
+					best, bestA, bestB = d, a, b
+				}
+			}
+		}
+		a, b := clusters[bestA], clusters[bestB]
+		height := best / 2
+		parent := new(Node)
+		a.node.Length = math.Max(0, height-a.height)
+		b.node.Length = math.Max(0, height-b.height)
+		parent.AddChild(a.node)
+		parent.AddChild(b.node)
+		clusters[bestA] = &cluster{
+			node:    parent,
+			members: append(append([]int{}, a.members...), b.members...),
+			height:  height,
+		}
+		clusters = append(clusters[:bestB], clusters[bestB+1:]...)
+	}
+	root := clusters[0].node
+	root.NameInternalNodes()
+	return root
+}
+
+// ReconstructAncestors reconstructs the Y-STR values of all internal
+// nodes of a tree by maximum parsimony. It uses the algorithm of Sankoff,
+// where the cost of a change is the number of mutation steps between
+// two values. The leaves must contain the Y-STR values of persons.
+// Missing values of leaves are treated as unknown.
+// Each value of a palindromic marker is reconstructed separately.
+// A nil tree is left unchanged.
+func ReconstructAncestors(root *Node, policy MicroallelePolicy) {
+	if root == nil {
+		return
+	}
+	nodes := root.Nodes()
+	leaves := root.Leaves()
+	for marker := range root.YstrMarkers {
+		// Collect the possible values.
+		states := make([]float64, 0)
+		isState := make(map[float64]bool)
+		for _, leaf := range leaves {
+			value := normalizeAllele(leaf.YstrMarkers[marker])
+			if value > 0 && !isState[value] {
+				isState[value] = true
+				states = append(states, value)
+			}
+		}
+		if len(states) == 0 {
+			continue
+		}
+		// costs contains the minimal number of mutations below a node
+		// for each possible state of the node.
+		costs := make(map[*Node][]float64)
+		// Calculate costs bottom up, so nodes are visited in reverse preorder.
+		for i := len(nodes) - 1; i >= 0; i-- {
+			node := nodes[i]
+			cost := make([]float64, len(states))
+			if node.IsLeaf() {
+				value := normalizeAllele(node.YstrMarkers[marker])
+				for s, state := range states {
+					if value > 0 && state != value {
+						cost[s] = math.Inf(1)
+					}
+				}
+			} else {
+				for s, state := range states {
+					for _, child := range node.Children {
+						best := math.Inf(1)
+						for c, childState := range states {
+							best = math.Min(best, costs[child][c]+steps(state, childState, policy))
+						}
+						cost[s] += best
+					}
+				}
+			}
+			costs[node] = cost
+		}
+		// Choose states top down.
+		chosen := make(map[*Node]int)
+		for _, node := range nodes {
+			best := math.Inf(1)
+			for s, state := range states {
+				cost := costs[node][s]
+				if node.Parent != nil {
+					cost += steps(states[chosen[node.Parent]], state, policy)
+				}
+				// If two states have the same cost choose the lower one.
+				if cost < best || (cost == best && state < states[chosen[node]]) {
+					best = cost
+					chosen[node] = s
+				}
+			}
+			if !node.IsLeaf() {
+				node.YstrMarkers[marker] = states[chosen[node]]
+			}
+		}
+	}
+}
+
+// Mutation is a change of a marker value on a branch of a tree.
+type Mutation struct {
+	Marker int
+	From   float64
+	To     float64
+}
+
+// Mutations returns the mutations on the branch from the parent
+// node to n. Markers with missing values are ignored.
+func (n *Node) Mutations() []Mutation {
+	result := make([]Mutation, 0)
+	if n.Parent == nil {
+		return result
+	}
+	for marker := 0; marker < MaxMarkers; marker++ {
+		from := normalizeAllele(n.Parent.YstrMarkers[marker])
+		to := normalizeAllele(n.YstrMarkers[marker])
+		if from > 0 && to > 0 && from != to {
+			result = append(result, Mutation{marker, from, to})
+		}
+	}
+	return result
+}
+
+// MutationsReport returns a report that lists the mutations on
+// every branch of the tree. The values of internal nodes should
+// have been reconstructed by ReconstructAncestors.
+// The report of a nil tree is empty.
+func MutationsReport(root *Node) string {
+	var buffer bytes.Buffer
+	if root == nil {
+		return buffer.String()
+	}
+	for _, node := range root.Nodes() {
+		if node.Parent == nil {
+			continue
+		}
+		buffer.WriteString(fmt.Sprintf("%s -> %s:", node.Parent.Name, node.Name))
+		mutations := node.Mutations()
+		if len(mutations) == 0 {
+			buffer.WriteString(" no mutations")
+		}
+		for _, m := range mutations {
+			buffer.WriteString(fmt.Sprintf(" %s %g>%g", YstrMarkerTable[m.Marker].InternalName, m.From, m.To))
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String()
+}
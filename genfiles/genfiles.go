@@ -8,9 +8,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -35,14 +39,28 @@ import (
 // labelCol is the number of the colum used as a label for
 // the person.
 func ReadPersonsFromCSV(filename string, labelCol int) ([]*genetic.Person, error) {
+	return ReadPersonsFromCSVWithGroups(filename, labelCol, -1)
+}
+
+// ReadPersonsFromCSVWithGroups reads persons' data from a CSV file
+// like ReadPersonsFromCSV and stores the content of the column
+// groupCol in the person's Group field.
+// If groupCol is < 0, no group is read.
+func ReadPersonsFromCSVWithGroups(filename string, labelCol, groupCol int) ([]*genetic.Person, error) {
 	infile, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer infile.Close()
+	return ReadPersonsFromCSVReader(infile, labelCol, groupCol)
+}
 
-	// Read all CSV records from file.
-	csvReader := csv.NewReader(infile)
+// ReadPersonsFromCSVReader reads persons' data in CSV format
+// from a reader, for example from standard input.
+// It works like ReadPersonsFromCSVWithGroups.
+func ReadPersonsFromCSVReader(reader io.Reader, labelCol, groupCol int) ([]*genetic.Person, error) {
+	// Read all CSV records.
+	csvReader := csv.NewReader(reader)
 	csvReader.FieldsPerRecord = -1
 	records, err := csvReader.ReadAll()
 	if err != nil {
@@ -75,7 +93,7 @@ func ReadPersonsFromCSV(filename string, labelCol int) ([]*genetic.Person, error
 	// Extract persons data from CSV records.
 	persons := make([]*genetic.Person, 0, 1000)
 	for _, record := range sampleRecords {
-		person, err := personFromFields(record, labelCol, strIdx, isFTDNA)
+		person, err := personFromFields(record, labelCol, groupCol, strIdx, isFTDNA)
 		if err == nil {
 			persons = append(persons, person)
 		}
@@ -108,10 +126,12 @@ func strIndex(fields []string) int {
 //
 // The first field must contain the ID of the person.
 // labelIdx is the field's index that is used for the person's Label field.
+// groupIdx is the field's index that is used for the person's Group field.
+// If groupIdx is < 0 or >= strIdx, no group is set.
 // strIdx is the index of the first STR marker value.
 // isFTDNA determines if the format of the fields is Family Tree DNA like
 // with palindromic values separated by "-" or not.
-func personFromFields(fields []string, labelIdx, strIdx int, isFTDNA bool) (*genetic.Person, error) {
+func personFromFields(fields []string, labelIdx, groupIdx, strIdx int, isFTDNA bool) (*genetic.Person, error) {
 	var person genetic.Person
 	var err error
 
@@ -122,7 +142,10 @@ func personFromFields(fields []string, labelIdx, strIdx int, isFTDNA bool) (*gen
 		return nil, errors.New("could not determine person ID")
 	}
 
-	person.Label = stringToLabel(strings.TrimSpace(fields[labelIdx]))
+	person.Label = StringToLabel(strings.TrimSpace(fields[labelIdx]))
+	if groupIdx >= 0 && groupIdx < strIdx {
+		person.Group = strings.TrimSpace(fields[groupIdx])
+	}
 	if isFTDNA {
 		person.YstrMarkers, err = extractYstrMarkersFTDNA(fields[strIdx:])
 	} else {
@@ -258,17 +281,24 @@ func stringToSTR(value string) (float64, error) {
 // Label field that is used for output in distance matrices.
 // Missing Y-STR values are set to 0.
 func ReadPersonsFromTXT(filename string) ([]*genetic.Person, error) {
-	lines := make([]string, 0, 1000)
-
 	// Open file
 	infile, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer infile.Close()
+	return ReadPersonsFromTXTReader(infile)
+}
+
+// ReadPersonsFromTXTReader reads persons' data in text format
+// from a reader, for example from standard input.
+// It works like ReadPersonsFromTXT.
+func ReadPersonsFromTXTReader(reader io.Reader) ([]*genetic.Person, error) {
+	var err error
+	lines := make([]string, 0, 1000)
 
 	// Read lines
-	scanner := bufio.NewScanner(infile)
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		// Name must have exactly 10 characters.
 		// This makes sure that empty lines are ignored
@@ -305,7 +335,12 @@ func ReadPersonsFromTXT(filename string) ([]*genetic.Person, error) {
 // ReadPersonsFromDir reads persons from the specified directory.
 // All files including data must have the extension ".csv" and be
 // in YFull Y-STR data format.
-func ReadPersonsFromDir(dirName string) ([]*genetic.Person, error) {
+// Notices about invalid files and values are written to messages.
+// If messages is nil they are discarded.
+func ReadPersonsFromDir(dirName string, messages io.Writer) ([]*genetic.Person, error) {
+	if messages == nil {
+		messages = ioutil.Discard
+	}
 	result := make([]*genetic.Person, 0, 100)
 	// Get list of input files.
 	infiles, err := namesWithExt(dirName, ".csv")
@@ -314,12 +349,12 @@ func ReadPersonsFromDir(dirName string) ([]*genetic.Person, error) {
 	}
 	// Read Y-STR data from input files.
 	for _, infile := range infiles {
-		person, err := ReadPersonFromYFull(filepath.Join(dirName, infile))
+		person, err := ReadPersonFromYFull(filepath.Join(dirName, infile), messages)
 		if err != nil {
 			// We do not return an error here because a
 			// single invalid file should not terminate the
 			// whole program.
-			fmt.Printf("Error! Could not read person from file %s, %s\n", infile, err)
+			fmt.Fprintf(messages, "Error! Could not read person from file %s, %s\n", infile, err)
 		} else {
 			result = append(result, person)
 		}
@@ -328,8 +363,14 @@ func ReadPersonsFromDir(dirName string) ([]*genetic.Person, error) {
 }
 
 // ReadPersonFromYFull reads a person from a YFull Y-STR results file.
+// Microalleles are stored as decimal numbers, see genetic.Microallele.
 // The Y-Full ID is extracted from the file name and used as the persons's ID.
-func ReadPersonFromYFull(filename string) (*genetic.Person, error) {
+// Notices about invalid values and the number of markers are written
+// to messages. If messages is nil they are discarded.
+func ReadPersonFromYFull(filename string, messages io.Writer) (*genetic.Person, error) {
+	if messages == nil {
+		messages = ioutil.Discard
+	}
 	infile, err := os.Open(filename)
 	if err != nil {
 		return nil, err
@@ -344,9 +385,9 @@ func ReadPersonFromYFull(filename string) (*genetic.Person, error) {
 	case err != nil:
 		return nil, err
 	case len(records) == 0:
-		return nil, errors.New(fmt.Sprintf("no data found in %s", infile))
+		return nil, errors.New(fmt.Sprintf("no data found in %s", filename))
 	case len(records[0]) < 2:
-		return nil, errors.New(fmt.Sprintf("invalid file format for %s", infile))
+		return nil, errors.New(fmt.Sprintf("invalid file format for %s", filename))
 	}
 
 	// Extract Y-STR marker values.
@@ -356,6 +397,9 @@ func ReadPersonFromYFull(filename string) (*genetic.Person, error) {
 		markerName := record[0]
 		markerValue := record[1]
 		if markerValue != "n/a" && markerValue != "" {
+			// Suffixes like ".a" denote a nucleotide variant inside
+			// a repeat and are removed. Microalleles like "13.2" are
+			// kept as they are.
 			if strings.HasSuffix(markerValue, ".a") ||
 				strings.HasSuffix(markerValue, ".g") ||
 				strings.HasSuffix(markerValue, ".c") ||
@@ -365,14 +409,14 @@ func ReadPersonFromYFull(filename string) (*genetic.Person, error) {
 			value, err := strconv.ParseFloat(markerValue, 64)
 			if err != nil {
 				// This may happen. So just print out a notice.
-				fmt.Printf("Error reading YFull marker value in file %s, %s.\n", filename, err)
+				fmt.Fprintf(messages, "Error reading YFull marker value in file %s, %s.\n", filename, err)
 			} else {
 				index, exists := genetic.YFullToIndex(markerName)
 				if exists {
 					result.YstrMarkers[index] = value
 					count++
 				} else {
-					fmt.Printf("Unknown marker %s found in file %s.\n", markerName, filename)
+					fmt.Fprintf(messages, "Unknown marker %s found in file %s.\n", markerName, filename)
 				}
 			}
 		}
@@ -380,8 +424,8 @@ func ReadPersonFromYFull(filename string) (*genetic.Person, error) {
 	// Extract ID and name from filename.
 	result.ID = idFromFileName(filepath.Base(filename))
 	result.Name = filepath.Base(filename)
-	result.Label = stringToLabel(result.ID)
-	fmt.Printf("Number of markers for %s: %d\n", result.ID, count)
+	result.Label = StringToLabel(result.ID)
+	fmt.Fprintf(messages, "Number of markers for %s: %d\n", result.ID, count)
 	return &result, nil
 }
 
@@ -438,8 +482,13 @@ func WriteDistanceMatrix(filename string, persons []*genetic.Person, matrix *gen
 		return err
 	}
 	defer outfile.Close()
+	return WriteDistanceMatrixTo(outfile, persons, matrix)
+}
 
-	writer := bufio.NewWriter(outfile)
+// WriteDistanceMatrixTo writes a distance matrix in PHYLIP compatible
+// format to a writer, for example to standard output.
+func WriteDistanceMatrixTo(w io.Writer, persons []*genetic.Person, matrix *genetic.DistanceMatrix) error {
+	writer := bufio.NewWriter(w)
 	// Write number of entries
 	writer.WriteString(fmt.Sprintf("%d\n", matrix.Size))
 
@@ -455,6 +504,843 @@ func WriteDistanceMatrix(filename string, persons []*genetic.Person, matrix *gen
 		}
 		writer.WriteString("\n")
 	}
+	return writer.Flush()
+}
+
+// WriteNewickTree writes a tree in Newick format. Leaves are named
+// by their Name field, which is usually the person's label.
+func WriteNewickTree(filename string, tree *genetic.Node) error {
+	leafName := func(leaf *genetic.Node) string {
+		return leaf.Name
+	}
+	text := newickString(tree, leafName) + ";\n"
+	return ioutil.WriteFile(filename, []byte(text), os.ModePerm)
+}
+
+// WriteNexus writes a distance matrix in NEXUS format
+// (https://en.wikipedia.org/wiki/Nexus_file), which is used by
+// programs like SplitsTree and PAUP.
+// The file contains a TAXA and a DISTANCES block. If tree is not nil
+// a TREES block is added. Taxa are named by the persons' full names,
+// see TaxonNames. Distances that are flagged in the matrix are
+// followed by the comment [flagged]. Distances that can not be
+// calculated, because two persons have no compared markers, are
+// written as missing values (?). All leaves of the tree must belong
+// to persons, otherwise an error is returned.
+func WriteNexus(filename string, persons []*genetic.Person, matrix *genetic.DistanceMatrix, tree *genetic.Node) error {
+	names := TaxonNames(persons)
+	// Map persons to taxon names.
+	taxa := make(map[*genetic.Person]string)
+	for i, person := range persons {
+		taxa[person] = names[i]
+	}
+	// All leaves of the tree must be taxa.
+	if tree != nil {
+		unmapped := make([]string, 0)
+		for _, leaf := range tree.Leaves() {
+			if _, exists := taxa[leaf.Person]; !exists {
+				unmapped = append(unmapped, leaf.Name)
+			}
+		}
+		if len(unmapped) > 0 {
+			return errors.New("tree leaves without persons: " + strings.Join(unmapped, ", "))
+		}
+	}
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	writer := bufio.NewWriter(outfile)
+	writer.WriteString("#NEXUS\n\n")
+
+	// Write taxa.
+	writer.WriteString("BEGIN TAXA;\n")
+	writer.WriteString(fmt.Sprintf("\tDIMENSIONS NTAX=%d;\n", matrix.Size))
+	writer.WriteString("\tTAXLABELS\n")
+	for row := 0; row < matrix.Size; row++ {
+		writer.WriteString("\t\t" + nexusName(names[row]) + "\n")
+	}
+	writer.WriteString("\t;\nEND;\n\n")
+
+	// Write distances.
+	writer.WriteString("BEGIN DISTANCES;\n")
+	writer.WriteString(fmt.Sprintf("\tDIMENSIONS NTAX=%d;\n", matrix.Size))
+	writer.WriteString("\tFORMAT TRIANGLE=BOTH LABELS=LEFT DIAGONAL MISSING=?;\n")
+	isFlagged := false
+	for row := 0; row < matrix.Size; row++ {
+		for col := 0; col < matrix.Size; col++ {
+			isFlagged = isFlagged || matrix.IsFlagged(row, col)
+		}
+	}
+	if isFlagged {
+		writer.WriteString("\t[Flagged distances are based on too few compared markers.]\n")
+	}
+	writer.WriteString("\tMATRIX\n")
+	for row := 0; row < matrix.Size; row++ {
+		writer.WriteString("\t\t" + nexusName(names[row]))
+		for col := 0; col < matrix.Size; col++ {
+			value := "?"
+			if !math.IsNaN(matrix.Values[row][col]) && !math.IsInf(matrix.Values[row][col], 0) {
+				value = strconv.FormatFloat(matrix.Values[row][col], 'f', -1, 64)
+			}
+			if matrix.IsFlagged(row, col) {
+				value += "[flagged]"
+			}
+			writer.WriteString(" " + value)
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString("\t;\nEND;\n")
+
+	// Write tree.
+	if tree != nil {
+		leafName := func(leaf *genetic.Node) string {
+			return nexusName(taxa[leaf.Person])
+		}
+		writer.WriteString("\nBEGIN TREES;\n")
+		writer.WriteString("\tTREE tree1 = [&R] " + newickString(tree, leafName) + ";\n")
+		writer.WriteString("END;\n")
+	}
+	err = writer.Flush()
+	return err
+}
+
+// TaxonNames returns a unique name for each person.
+// The name is the person's Name, or the ID or Label if the name is empty.
+// If a name occurs more than once a number is appended.
+func TaxonNames(persons []*genetic.Person) []string {
+	result := make([]string, len(persons))
+	counts := make(map[string]int)
+	for i, person := range persons {
+		name := strings.TrimSpace(person.Name)
+		if name == "" {
+			name = strings.TrimSpace(person.ID)
+		}
+		if name == "" {
+			name = person.Label
+		}
+		counts[name]++
+		if counts[name] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, counts[name])
+		}
+		result[i] = name
+	}
+	return result
+}
+
+// nexusName quotes a name for NEXUS files if necessary.
+// Single quotes inside a name are doubled.
+func nexusName(name string) string {
+	if name != "" && !strings.ContainsAny(name, " \t\n()[]{}/\\,;:=*'\"`+-<>") {
+		return name
+	}
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
+
+// newickString returns a tree in Newick format without the
+// terminating semicolon. leafName returns the name of a leaf.
+// Internal nodes are written without names.
+func newickString(node *genetic.Node, leafName func(*genetic.Node) string) string {
+	var text string
+	if node.IsLeaf() {
+		text = leafName(node)
+	} else {
+		children := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			children[i] = newickString(child, leafName)
+		}
+		text = "(" + strings.Join(children, ",") + ")"
+	}
+	if node.Parent != nil {
+		text += ":" + strconv.FormatFloat(node.Length, 'f', -1, 64)
+	}
+	return text
+}
+
+// WriteRDF writes persons' Y-STR values in the RDF format of the
+// Network program by Fluxus Technology (http://www.fluxus-engineering.com)
+// for the calculation of median-joining networks.
+//
+// The file starts with the marker names and a weight of 10 for each
+// marker. Each person is written as a taxon with a frequency of 1,
+// named by its Label. Multi-copy markers (see genetic.IsMultiCopy) are
+// excluded, because Network can not handle them. Network only accepts whole
+// repeats, so microalleles are truncated. Missing values are left empty.
+//
+// nMarkers is the number of Y-STR values that is considered.
+func WriteRDF(filename string, persons []*genetic.Person, nMarkers int) error {
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	markers := genetic.SingleCopyMarkers(persons, nMarkers, false)
+	writer := bufio.NewWriter(outfile)
+	writer.WriteString("  ;1.0\n")
+	// Write marker names and weights.
+	for _, marker := range markers {
+		writer.WriteString(";" + genetic.YstrMarkerTable[marker].InternalName)
+	}
+	writer.WriteString("\n")
+	for range markers {
+		writer.WriteString(";10")
+	}
+	writer.WriteString("\n")
+	// Write taxa.
+	for _, person := range persons {
+		writer.WriteString(">" + person.Label + ";1;\n")
+		for i, marker := range markers {
+			if i > 0 {
+				writer.WriteString(";")
+			}
+			if value := person.YstrMarkers[marker]; value > 0 {
+				repeats, _ := genetic.Microallele(value)
+				writer.WriteString(strconv.Itoa(repeats))
+			}
+		}
+		writer.WriteString("\n")
+	}
+	err = writer.Flush()
+	return err
+}
+
+// stateSymbols are the symbols for character states in NEXUS files.
+const stateSymbols = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// WritePopART writes persons' Y-STR values in NEXUS format for
+// PopART (http://popart.otago.ac.nz) to calculate haplotype networks.
+//
+// Each marker is a character of the STANDARD data type. Its values
+// are coded as states in ascending order, starting from 0, and the
+// original values are written as state labels. Multi-copy markers
+// (see genetic.IsMultiCopy) are excluded and missing values are
+// written as "?".
+// Taxa are named by the persons' full names, see TaxonNames.
+//
+// traits determines the content of the TRAITS block, which PopART
+// uses to color the network. It can be "group" for the persons'
+// Group field, "origin" for the Origin field or "" for no traits.
+// Persons without a trait value are assigned to the trait "unknown".
+//
+// nMarkers is the number of Y-STR values that is considered.
+func WritePopART(filename string, persons []*genetic.Person, nMarkers int, traits string) error {
+	var trait func(*genetic.Person) string
+	if traits != "" {
+		var err error
+		trait, err = traitFunc(traits)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Code the values of each marker as states.
+	markers := genetic.SingleCopyMarkers(persons, nMarkers, false)
+	states := make([][]float64, len(markers))
+	for i, marker := range markers {
+		for _, person := range persons {
+			value := person.YstrMarkers[marker]
+			if value > 0 && indexOf(states[i], value) < 0 {
+				states[i] = append(states[i], value)
+			}
+		}
+		if len(states[i]) > len(stateSymbols) {
+			return fmt.Errorf("marker %s has more than %d different values",
+				genetic.YstrMarkerTable[marker].InternalName, len(stateSymbols))
+		}
+		sort.Float64s(states[i])
+	}
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	names := TaxonNames(persons)
+	writer := bufio.NewWriter(outfile)
+	writer.WriteString("#NEXUS\n\n")
+
+	// Write taxa.
+	writer.WriteString("BEGIN TAXA;\n")
+	writer.WriteString(fmt.Sprintf("\tDIMENSIONS NTAX=%d;\n", len(persons)))
+	writer.WriteString("\tTAXLABELS\n")
+	for _, name := range names {
+		writer.WriteString("\t\t" + nexusName(name) + "\n")
+	}
+	writer.WriteString("\t;\nEND;\n\n")
+
+	// Write characters.
+	nStates := 1
+	for _, s := range states {
+		if len(s) > nStates {
+			nStates = len(s)
+		}
+	}
+	symbols := strings.Join(strings.Split(stateSymbols[:nStates], ""), " ")
+	writer.WriteString("BEGIN CHARACTERS;\n")
+	writer.WriteString(fmt.Sprintf("\tDIMENSIONS NCHAR=%d;\n", len(markers)))
+	writer.WriteString(fmt.Sprintf("\tFORMAT DATATYPE=STANDARD MISSING=? SYMBOLS=\"%s\";\n", symbols))
+	writer.WriteString("\tCHARSTATELABELS\n")
+	for i, marker := range markers {
+		labels := make([]string, len(states[i]))
+		for s, value := range states[i] {
+			labels[s] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		separator := ","
+		if i == len(markers)-1 {
+			separator = ""
+		}
+		writer.WriteString(fmt.Sprintf("\t\t%d %s / %s%s\n", i+1,
+			nexusName(genetic.YstrMarkerTable[marker].InternalName), strings.Join(labels, " "), separator))
+	}
+	writer.WriteString("\t;\n")
+	writer.WriteString("\tMATRIX\n")
+	for p, person := range persons {
+		writer.WriteString("\t\t" + nexusName(names[p]) + " ")
+		for i, marker := range markers {
+			if s := indexOf(states[i], person.YstrMarkers[marker]); s >= 0 {
+				writer.WriteByte(stateSymbols[s])
+			} else {
+				writer.WriteString("?")
+			}
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString("\t;\nEND;\n")
+
+	// Write traits.
+	if trait != nil {
+		traitNames := make([]string, 0)
+		for _, person := range persons {
+			name := traitName(trait(person))
+			if indexOfString(traitNames, name) < 0 {
+				traitNames = append(traitNames, name)
+			}
+		}
+		labels := make([]string, len(traitNames))
+		for i, name := range traitNames {
+			labels[i] = nexusName(name)
+		}
+		writer.WriteString("\nBEGIN TRAITS;\n")
+		writer.WriteString(fmt.Sprintf("\tDIMENSIONS NTRAITS=%d;\n", len(traitNames)))
+		writer.WriteString("\tFORMAT LABELS=YES MISSING=? SEPARATOR=COMMA;\n")
+		writer.WriteString("\tTRAITLABELS " + strings.Join(labels, " ") + ";\n")
+		writer.WriteString("\tMATRIX\n")
+		for p, person := range persons {
+			counts := make([]string, len(traitNames))
+			for i := range counts {
+				counts[i] = "0"
+			}
+			counts[indexOfString(traitNames, traitName(trait(person)))] = "1"
+			writer.WriteString("\t\t" + nexusName(names[p]) + " " + strings.Join(counts, ",") + "\n")
+		}
+		writer.WriteString("\t;\nEND;\n")
+	}
+	err = writer.Flush()
+	return err
+}
+
+// traitFunc returns a function that returns the trait of a person.
+// traits can be "group" for the person's Group field or "origin"
+// for the Origin field.
+func traitFunc(traits string) (func(*genetic.Person) string, error) {
+	switch traits {
+	case "group":
+		return func(p *genetic.Person) string { return p.Group }, nil
+	case "origin":
+		return func(p *genetic.Person) string { return p.Origin }, nil
+	default:
+		return nil, errors.New("unknown traits: " + traits)
+	}
+}
+
+// traitName returns the name of a trait.
+// Empty names are replaced by "unknown".
+func traitName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// indexOf returns the index of value in values or -1
+// if values does not contain value.
+func indexOf(values []float64, value float64) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOfString returns the index of s in list or -1
+// if list does not contain s.
+func indexOfString(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// populationPersons returns the populations that are exported for
+// population analysis and all of their members. Noise clusters,
+// which contain the persons without a population, and empty
+// populations are left out, like in genetic.NewPopulationStatistics.
+func populationPersons(populations []*genetic.Cluster) ([]*genetic.Cluster, []*genetic.Person) {
+	exported := make([]*genetic.Cluster, 0, len(populations))
+	persons := make([]*genetic.Person, 0)
+	for _, population := range populations {
+		if population.IsNoise() || len(population.Persons) == 0 {
+			continue
+		}
+		exported = append(exported, population)
+		persons = append(persons, population.Persons...)
+	}
+	return exported, persons
+}
+
+// populationMarkerName returns the name of a marker for population
+// analysis. If convert389 is true, DYS389ii is named DYS389ii-i.
+func populationMarkerName(marker int, convert389 bool) string {
+	if convert389 && marker == genetic.DYS389ii {
+		return "DYS389ii-i"
+	}
+	return genetic.YstrMarkerTable[marker].InternalName
+}
+
+// populationAllele returns the value of a marker as a whole number of
+// repeats, because population genetics programs can not handle
+// microalleles. If convert389 is true, the value of DYS389i is
+// subtracted from DYS389ii. isPresent is false for missing values.
+func populationAllele(person *genetic.Person, marker int, convert389 bool) (value int, isPresent bool) {
+	v := person.YstrMarkers[marker]
+	if convert389 && marker == genetic.DYS389ii {
+		if person.YstrMarkers[genetic.DYS389i] <= 0 {
+			return 0, false
+		}
+		v -= person.YstrMarkers[genetic.DYS389i]
+	}
+	if v <= 0 {
+		return 0, false
+	}
+	repeats, _ := genetic.Microallele(v)
+	return repeats, true
+}
+
+// WriteArlequin writes persons' Y-STR values as haploid microsatellite
+// data in the project format of Arlequin
+// (http://cmpg.unibe.ch/software/arlequin35/) for AMOVA and Fst
+// calculations. Each population is written as a sample and all
+// samples are put into a single group in the structure section.
+//
+// Populations are usually created by genetic.ClustersByOrigin or
+// genetic.ClustersByGroup. Noise clusters are not written.
+// Only the markers that are used by genetic.NewPopulationStatistics
+// are written: single-copy markers that have been tested by all persons
+// of the populations (see genetic.SingleCopyMarkers). Microalleles are
+// truncated to whole repeats.
+// If convert389 is true DYS389ii is replaced by DYS389ii-i.
+//
+// nMarkers is the number of Y-STR values that is considered.
+func WriteArlequin(filename string, populations []*genetic.Cluster, nMarkers int, convert389 bool) error {
+	populations, persons := populationPersons(populations)
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	markers := genetic.SingleCopyMarkers(persons, nMarkers, true)
+	markerNames := make([]string, len(markers))
+	for i, marker := range markers {
+		markerNames[i] = populationMarkerName(marker, convert389)
+	}
+	writer := bufio.NewWriter(outfile)
+	writer.WriteString("[Profile]\n")
+	writer.WriteString("\tTitle=\"Y-STR data exported by phylofriend\"\n")
+	writer.WriteString(fmt.Sprintf("\tNbSamples=%d\n", len(populations)))
+	writer.WriteString("\tDataType=MICROSAT\n")
+	writer.WriteString("\tGenotypicData=0\n")
+	writer.WriteString("\tLocusSeparator=WHITESPACE\n")
+	writer.WriteString("\tMissingData='?'\n\n")
+	writer.WriteString("[Data]\n")
+	writer.WriteString("# Markers: " + strings.Join(markerNames, " ") + "\n")
+	writer.WriteString("[[Samples]]\n")
+	for _, population := range populations {
+		writer.WriteString(fmt.Sprintf("\tSampleName=%s\n", strconv.Quote(population.Name)))
+		writer.WriteString(fmt.Sprintf("\tSampleSize=%d\n", len(population.Persons)))
+		writer.WriteString("\tSampleData={\n")
+		for _, person := range population.Persons {
+			writer.WriteString("\t\t" + person.Label + " 1")
+			for _, marker := range markers {
+				if value, isPresent := populationAllele(person, marker, convert389); isPresent {
+					writer.WriteString(" " + strconv.Itoa(value))
+				} else {
+					writer.WriteString(" ?")
+				}
+			}
+			writer.WriteString("\n")
+		}
+		writer.WriteString("\t}\n")
+	}
+	writer.WriteString("\n[[Structure]]\n")
+	writer.WriteString("\tStructureName=\"All populations\"\n")
+	writer.WriteString("\tNbGroups=1\n")
+	writer.WriteString("\tGroup={\n")
+	for _, population := range populations {
+		writer.WriteString("\t\t" + strconv.Quote(population.Name) + "\n")
+	}
+	writer.WriteString("\t}\n")
+	err = writer.Flush()
+	return err
+}
+
+// WriteGenAlEx writes persons' Y-STR values in the layout of
+// GenAlEx (https://biology-assets.anu.edu.au/GenAlEx/) as a CSV file
+// that can be opened in a spreadsheet.
+// The first row contains the number of loci, persons and populations
+// and the size of each population. The second row contains the
+// population names and the third row the column headers.
+// Persons are ordered by population.
+//
+// Populations are usually created by genetic.ClustersByOrigin or
+// genetic.ClustersByGroup. Noise clusters are not written.
+// Only the markers that are used by genetic.NewPopulationStatistics
+// are written: single-copy markers that have been tested by all persons
+// of the populations (see genetic.SingleCopyMarkers). Microalleles are
+// truncated to whole repeats.
+// If convert389 is true DYS389ii is replaced by DYS389ii-i.
+//
+// nMarkers is the number of Y-STR values that is considered.
+func WriteGenAlEx(filename string, populations []*genetic.Cluster, nMarkers int, convert389 bool) error {
+	populations, persons := populationPersons(populations)
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	markers := genetic.SingleCopyMarkers(persons, nMarkers, true)
+	writer := csv.NewWriter(outfile)
+	// Write header.
+	sizes := []string{strconv.Itoa(len(markers)), strconv.Itoa(len(persons)), strconv.Itoa(len(populations))}
+	names := []string{"Y-STR", "", ""}
+	for _, population := range populations {
+		sizes = append(sizes, strconv.Itoa(len(population.Persons)))
+		names = append(names, population.Name)
+	}
+	writer.Write(sizes)
+	writer.Write(names)
+	header := []string{"Sample", "Pop"}
+	for _, marker := range markers {
+		header = append(header, populationMarkerName(marker, convert389))
+	}
+	writer.Write(header)
+	// Write persons.
+	for _, population := range populations {
+		for _, person := range population.Persons {
+			record := []string{person.Label, population.Name}
+			for _, marker := range markers {
+				value, _ := populationAllele(person, marker, convert389)
+				record = append(record, strconv.Itoa(value))
+			}
+			writer.Write(record)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// networkJSON is the file format of a haplotype network in JSON format.
+type networkJSON struct {
+	Markers  []string
+	Vertices []vertexJSON
+	Edges    []edgeJSON
+}
+
+// vertexJSON is a vertex of a haplotype network in JSON format.
+// Values contains the marker values in the order of the network's markers.
+type vertexJSON struct {
+	Name     string
+	IsMedian bool
+	Persons  []string
+	Values   []float64
+}
+
+// edgeJSON is an edge of a haplotype network in JSON format.
+type edgeJSON struct {
+	From      string
+	To        string
+	Distance  float64
+	Mutations []string
+}
+
+// WriteNetworkJSON writes a haplotype network in JSON format.
+// Persons are identified by their labels. Mutations are written
+// like "DYS393 13>14".
+func WriteNetworkJSON(filename string, network *genetic.Network) error {
+	data := networkJSON{
+		Markers:  make([]string, len(network.Markers)),
+		Vertices: make([]vertexJSON, len(network.Vertices)),
+		Edges:    make([]edgeJSON, len(network.Edges)),
+	}
+	for i, marker := range network.Markers {
+		data.Markers[i] = genetic.YstrMarkerTable[marker].InternalName
+	}
+	for i, v := range network.Vertices {
+		vertex := vertexJSON{
+			Name:     v.Name,
+			IsMedian: v.IsMedian,
+			Persons:  make([]string, len(v.Persons)),
+			Values:   make([]float64, len(network.Markers)),
+		}
+		for p, person := range v.Persons {
+			vertex.Persons[p] = person.Label
+		}
+		for m, marker := range network.Markers {
+			vertex.Values[m] = v.YstrMarkers[marker]
+		}
+		data.Vertices[i] = vertex
+	}
+	for i, e := range network.Edges {
+		data.Edges[i] = edgeJSON{
+			From:      network.Vertices[e.From].Name,
+			To:        network.Vertices[e.To].Name,
+			Distance:  e.Distance,
+			Mutations: mutationNames(e.Mutations),
+		}
+	}
+	text, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, text, os.ModePerm)
+}
+
+// WriteNetworkGraphML writes a haplotype network in GraphML format
+// (http://graphml.graphdrawing.org), which can be read by graph
+// programs like Cytoscape, Gephi or yEd.
+// Vertices are identified by their names. Each vertex contains the
+// number and the labels of its persons. Each edge contains the
+// distance and the mutations.
+func WriteNetworkGraphML(filename string, network *genetic.Network) error {
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	writer := bufio.NewWriter(outfile)
+	writer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	writer.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	writer.WriteString("  <key id=\"persons\" for=\"node\" attr.name=\"persons\" attr.type=\"int\"/>\n")
+	writer.WriteString("  <key id=\"labels\" for=\"node\" attr.name=\"labels\" attr.type=\"string\"/>\n")
+	writer.WriteString("  <key id=\"median\" for=\"node\" attr.name=\"median\" attr.type=\"boolean\"/>\n")
+	writer.WriteString("  <key id=\"distance\" for=\"edge\" attr.name=\"distance\" attr.type=\"double\"/>\n")
+	writer.WriteString("  <key id=\"mutations\" for=\"edge\" attr.name=\"mutations\" attr.type=\"string\"/>\n")
+	writer.WriteString("  <graph id=\"network\" edgedefault=\"undirected\">\n")
+	for _, v := range network.Vertices {
+		labels := make([]string, len(v.Persons))
+		for i, person := range v.Persons {
+			labels[i] = person.Label
+		}
+		writer.WriteString(fmt.Sprintf("    <node id=\"%s\">\n", html.EscapeString(v.Name)))
+		writer.WriteString(fmt.Sprintf("      <data key=\"persons\">%d</data>\n", len(v.Persons)))
+		writer.WriteString(fmt.Sprintf("      <data key=\"labels\">%s</data>\n", html.EscapeString(strings.Join(labels, " "))))
+		writer.WriteString(fmt.Sprintf("      <data key=\"median\">%t</data>\n", v.IsMedian))
+		writer.WriteString("    </node>\n")
+	}
+	for _, e := range network.Edges {
+		writer.WriteString(fmt.Sprintf("    <edge source=\"%s\" target=\"%s\">\n",
+			html.EscapeString(network.Vertices[e.From].Name), html.EscapeString(network.Vertices[e.To].Name)))
+		writer.WriteString(fmt.Sprintf("      <data key=\"distance\">%s</data>\n", strconv.FormatFloat(e.Distance, 'f', -1, 64)))
+		writer.WriteString(fmt.Sprintf("      <data key=\"mutations\">%s</data>\n", html.EscapeString(strings.Join(mutationNames(e.Mutations), ", "))))
+		writer.WriteString("    </edge>\n")
+	}
+	writer.WriteString("  </graph>\n</graphml>\n")
+	err = writer.Flush()
+	return err
+}
+
+// WriteNetworkSVG draws a haplotype network as an SVG image.
+// The layout is calculated by a simple force directed algorithm,
+// see layoutNetwork. The area of a vertex is proportional to the
+// number of its persons and median vectors are drawn as small black
+// dots. Vertices are colored by the group of their persons if all
+// persons belong to the same group. Edges are labeled by their distance.
+func WriteNetworkSVG(filename string, network *genetic.Network) error {
+	const (
+		scale  = 40.0
+		margin = 60.0
+	)
+	positions := layoutNetwork(network)
+	// Determine the size of the image.
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range positions {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	if len(positions) == 0 {
+		minX, maxX, minY, maxY = 0, 0, 0, 0
+	}
+	x := func(i int) float64 { return margin + (positions[i][0]-minX)*scale }
+	y := func(i int) float64 { return margin + (positions[i][1]-minY)*scale }
+	width := 2*margin + (maxX-minX)*scale
+	height := 2*margin + (maxY-minY)*scale
+
+	// Assign colors to groups.
+	colors := []string{"#e41a1c", "#377eb8", "#4daf4a", "#984ea3", "#ff7f00", "#ffff33", "#a65628", "#f781bf"}
+	groupColors := make(map[string]string)
+	fill := func(v *genetic.Vertex) string {
+		group := v.Persons[0].Group
+		for _, person := range v.Persons {
+			if person.Group != group {
+				return "#cccccc"
+			}
+		}
+		if group == "" {
+			return "#ffffff"
+		}
+		if _, exists := groupColors[group]; !exists {
+			groupColors[group] = colors[len(groupColors)%len(colors)]
+		}
+		return groupColors[group]
+	}
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	writer := bufio.NewWriter(outfile)
+	writer.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" font-family=\"sans-serif\" font-size=\"10\">\n", width, height))
+	writer.WriteString(fmt.Sprintf("<rect width=\"%.0f\" height=\"%.0f\" fill=\"white\"/>\n", width, height))
+	for _, e := range network.Edges {
+		writer.WriteString(fmt.Sprintf("<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"black\"/>\n",
+			x(e.From), y(e.From), x(e.To), y(e.To)))
+		writer.WriteString(fmt.Sprintf("<text x=\"%.1f\" y=\"%.1f\" fill=\"gray\">%s</text>\n",
+			(x(e.From)+x(e.To))/2, (y(e.From)+y(e.To))/2, strconv.FormatFloat(e.Distance, 'f', -1, 64)))
+	}
+	for i, v := range network.Vertices {
+		if v.IsMedian {
+			writer.WriteString(fmt.Sprintf("<circle cx=\"%.1f\" cy=\"%.1f\" r=\"3\" fill=\"black\"><title>%s</title></circle>\n",
+				x(i), y(i), html.EscapeString(v.Name)))
+			continue
+		}
+		labels := make([]string, len(v.Persons))
+		for p, person := range v.Persons {
+			labels[p] = person.Label
+		}
+		radius := 6 * math.Sqrt(float64(len(v.Persons)))
+		writer.WriteString(fmt.Sprintf("<circle cx=\"%.1f\" cy=\"%.1f\" r=\"%.1f\" fill=\"%s\" stroke=\"black\"><title>%s</title></circle>\n",
+			x(i), y(i), radius, fill(v), html.EscapeString(strings.Join(labels, " "))))
+		writer.WriteString(fmt.Sprintf("<text x=\"%.1f\" y=\"%.1f\">%s</text>\n",
+			x(i)+radius+2, y(i)+4, html.EscapeString(v.Name)))
+	}
+	writer.WriteString("</svg>\n")
+	err = writer.Flush()
+	return err
+}
+
+// layoutNetwork calculates a position for each vertex of a network.
+// Connected vertices attract each other like springs, whose length is
+// the distance of the edge. All vertices repel each other.
+// The vertices start on a circle, so the result is deterministic.
+func layoutNetwork(network *genetic.Network) [][2]float64 {
+	n := len(network.Vertices)
+	positions := make([][2]float64, n)
+	for i := range positions {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		positions[i] = [2]float64{float64(n) * math.Cos(angle), float64(n) * math.Sin(angle)}
+	}
+	const iterations = 500
+	for iteration := 0; iteration < iterations; iteration++ {
+		// The step size decreases so that the layout settles down.
+		step := 0.1 * (1 - float64(iteration)/iterations)
+		forces := make([][2]float64, n)
+		// Repulsion between all vertices.
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dx := positions[i][0] - positions[j][0]
+				dy := positions[i][1] - positions[j][1]
+				d2 := math.Max(dx*dx+dy*dy, 0.01)
+				fx, fy := dx/d2, dy/d2
+				forces[i][0] += fx
+				forces[i][1] += fy
+				forces[j][0] -= fx
+				forces[j][1] -= fy
+			}
+		}
+		// Springs along edges.
+		for _, e := range network.Edges {
+			dx := positions[e.To][0] - positions[e.From][0]
+			dy := positions[e.To][1] - positions[e.From][1]
+			d := math.Max(math.Sqrt(dx*dx+dy*dy), 0.01)
+			f := (d - math.Max(e.Distance, 0.5)) / d
+			forces[e.From][0] += f * dx
+			forces[e.From][1] += f * dy
+			forces[e.To][0] -= f * dx
+			forces[e.To][1] -= f * dy
+		}
+		for i := range positions {
+			positions[i][0] += step * forces[i][0]
+			positions[i][1] += step * forces[i][1]
+		}
+	}
+	return positions
+}
+
+// mutationNames returns a description like "DYS393 13>14"
+// for each mutation.
+func mutationNames(mutations []genetic.Mutation) []string {
+	result := make([]string, len(mutations))
+	for i, m := range mutations {
+		result[i] = fmt.Sprintf("%s %g>%g", genetic.YstrMarkerTable[m.Marker].InternalName, m.From, m.To)
+	}
+	return result
+}
+
+// WriteComparedMatrix writes the number of compared marker values
+// for each pair of persons in the same format as WriteDistanceMatrix.
+func WriteComparedMatrix(filename string, persons []*genetic.Person, matrix *genetic.ComparedMatrix) error {
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	writer := bufio.NewWriter(outfile)
+	// Write number of entries
+	writer.WriteString(fmt.Sprintf("%d\n", matrix.Size))
+
+	// Write lines
+	for row := 0; row < matrix.Size; row++ {
+		writer.WriteString(persons[row].Label)
+		for col := 0; col < matrix.Size; col++ {
+			writer.WriteString("\t" + strconv.Itoa(matrix.Values[row][col]))
+		}
+		writer.WriteString("\n")
+	}
 	err = writer.Flush()
 	return err
 }
@@ -474,8 +1360,14 @@ func WritePersonsAsTXT(filename string, persons []*genetic.Person, nMarkers int)
 		return err
 	}
 	defer outfile.Close()
+	return WritePersonsAsTXTTo(outfile, persons, nMarkers)
+}
 
-	writer := bufio.NewWriter(outfile)
+// WritePersonsAsTXTTo writes person's genetic data in text format
+// to a writer, for example to standard output.
+// It works like WritePersonsAsTXT.
+func WritePersonsAsTXTTo(w io.Writer, persons []*genetic.Person, nMarkers int) error {
+	writer := bufio.NewWriter(w)
 	for _, person := range persons {
 		writer.WriteString(person.Label)
 		for i := 0; i < nMarkers; i++ {
@@ -484,26 +1376,75 @@ func WritePersonsAsTXT(filename string, persons []*genetic.Person, nMarkers int)
 		}
 		writer.WriteString("\n")
 	}
-	err = writer.Flush()
-	return err
+	return writer.Flush()
+}
+
+// WritePersonsAsCSV writes person's genetic data to a file in CSV format.
+// The columns are ID, Label, Group and the Y-STR values.
+// Each value of a palindromic marker is written into a separate column
+// and missing values are left empty. So the file can be read again by
+// ReadPersonsFromCSV using the label column 2.
+//
+// nMarkers is the number of Y-STR values that is written.
+func WritePersonsAsCSV(filename string, persons []*genetic.Person, nMarkers int) error {
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	writer := csv.NewWriter(outfile)
+	// Write header.
+	header := []string{"ID", "Label", "Group"}
+	for i := 0; i < nMarkers; i++ {
+		header = append(header, genetic.YstrMarkerTable[i].InternalName)
+	}
+	writer.Write(header)
+	// Write persons.
+	for _, person := range persons {
+		// ReadPersonsFromCSV needs an ID, so the label is used if there is none.
+		id := person.ID
+		if id == "" {
+			id = person.Label
+		}
+		record := []string{id, person.Label, person.Group}
+		for i := 0; i < nMarkers; i++ {
+			value := ""
+			if person.YstrMarkers[i] != 0 {
+				value = strconv.FormatFloat(person.YstrMarkers[i], 'f', -1, 64)
+			}
+			record = append(record, value)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
 }
 
 // WritePersonsAsHTML writes person's genetic data to a file in HTML format.
+// Imputed values are written in italics.
 //
 // nMarkers is the number of Y-STR values that is written. This
 // is usefull if not all persons have tested for the same number
 // of markers.
 func WritePersonsAsHTML(filename string, persons []*genetic.Person, nMarkers int) error {
-	modal := persons[0]
-
 	// Open file.
 	outfile, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer outfile.Close()
+	return WritePersonsAsHTMLTo(outfile, persons, nMarkers)
+}
 
-	writer := bufio.NewWriter(outfile)
+// WritePersonsAsHTMLTo writes person's genetic data in HTML format
+// to a writer, for example to standard output.
+// It works like WritePersonsAsHTML.
+func WritePersonsAsHTMLTo(w io.Writer, persons []*genetic.Person, nMarkers int) error {
+	modal := persons[0]
+
+	writer := bufio.NewWriter(w)
 	// Write header.
 	header := "<!DOCTYPE html>\n" +
 		"<html lang=\"en\">\n" +
@@ -532,9 +1473,12 @@ func WritePersonsAsHTML(filename string, persons []*genetic.Person, nMarkers int
 		writer.WriteString("<tr>")
 		for i := 0; i < nMarkers; i++ {
 			value := strconv.FormatFloat(person.YstrMarkers[i], 'f', -1, 64)
-			writer.WriteString("<td style=\"background-color:" +
-				colorCode(person.YstrMarkers[i], modal.YstrMarkers[i]) +
-				";\">" + value + "</td>")
+			style := "background-color:" + colorCode(person.YstrMarkers[i], modal.YstrMarkers[i]) + ";"
+			if person.IsImputed(i) {
+				// Imputed values are shown in italics.
+				style += " font-style:italic;"
+			}
+			writer.WriteString("<td style=\"" + style + "\">" + value + "</td>")
 		}
 		writer.WriteString("</tr>\n")
 	}
@@ -542,8 +1486,7 @@ func WritePersonsAsHTML(filename string, persons []*genetic.Person, nMarkers int
 	writer.WriteString("</div>\n")
 
 	writer.WriteString("</body>\n</html>")
-	err = writer.Flush()
-	return err
+	return writer.Flush()
 }
 
 // colorCode calculates a color for an Y-STR value depending on it's
@@ -577,6 +1520,197 @@ func colorCode(value, modal float64) string {
 	}
 }
 
+// WriteCountingRates writes mutation rates for marker counting,
+// where each marker with values has the same rate, see
+// MarkerStatistics.MutationRates. The file can be read by
+// ReadMutationRates. Use MarkerStatistics.Select to choose the markers.
+func WriteCountingRates(filename string, statistics *genetic.MarkerStatistics) error {
+	return ioutil.WriteFile(filename, []byte(statistics.MutationRates()), os.ModePerm)
+}
+
+// statisticsJSON contains marker statistics in JSON format.
+type statisticsJSON struct {
+	NSamples int
+	Markers  []markerStatisticsJSON
+}
+
+// markerStatisticsJSON contains the statistics of a single marker
+// in JSON format.
+type markerStatisticsJSON struct {
+	Marker string
+	// Frequency is the share of samples that have been
+	// tested for the marker.
+	Frequency float64
+	Samples   int
+	Min       float64
+	Max       float64
+	Alleles   []alleleJSON
+}
+
+// alleleJSON contains the number of occurrences and the
+// frequency of a single marker value.
+type alleleJSON struct {
+	Value     float64
+	Count     int
+	Frequency float64
+}
+
+// WriteStatistics writes marker statistics to a file.
+// Markers without values are omitted. Markers are ordered by their
+// index in YstrMarkerTable and the values in ascending order,
+// so the output is deterministic.
+//
+// If the filename ends with ".csv" the file is written in CSV format.
+// The alleles of each marker are written into a single column
+// like "13:6 14:12", where 13 and 14 are the values and 6 and 12
+// the number of occurrences. Otherwise the file is written in
+// JSON format.
+func WriteStatistics(filename string, statistics *genetic.MarkerStatistics) error {
+	data := statisticsJSON{NSamples: statistics.NSamples, Markers: make([]markerStatisticsJSON, 0)}
+	for marker := range statistics.Markers {
+		occurrences := statistics.Markers[marker].ValuesOccurrences
+		if occurrences == nil {
+			continue
+		}
+		values := statistics.Values(marker)
+		m := markerStatisticsJSON{
+			Marker:    genetic.YstrMarkerTable[marker].InternalName,
+			Frequency: statistics.Markers[marker].FrequencyAmongSamples,
+			Min:       values[0],
+			Max:       values[len(values)-1],
+			Alleles:   make([]alleleJSON, len(values)),
+		}
+		for _, count := range occurrences {
+			m.Samples += count
+		}
+		for i, value := range values {
+			m.Alleles[i] = alleleJSON{
+				Value:     value,
+				Count:     occurrences[value],
+				Frequency: float64(occurrences[value]) / float64(m.Samples),
+			}
+		}
+		data.Markers = append(data.Markers, m)
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		text, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filename, text, os.ModePerm)
+	}
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	writer := csv.NewWriter(outfile)
+	writer.Write([]string{"Marker", "Frequency", "Samples", "Values", "Min", "Max", "Alleles"})
+	for _, m := range data.Markers {
+		alleles := make([]string, len(m.Alleles))
+		for i, allele := range m.Alleles {
+			alleles[i] = format(allele.Value) + ":" + strconv.Itoa(allele.Count)
+		}
+		writer.Write([]string{m.Marker, format(m.Frequency), strconv.Itoa(m.Samples), strconv.Itoa(len(m.Alleles)),
+			format(m.Min), format(m.Max), strings.Join(alleles, " ")})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// diversityJSON contains the diversity of a group of persons
+// in JSON format.
+type diversityJSON struct {
+	Group   string
+	Summary genetic.DiversitySummary
+	Markers []markerDiversityJSON
+}
+
+// markerDiversityJSON contains the diversity of a single marker
+// in JSON format.
+type markerDiversityJSON struct {
+	Marker           string
+	Samples          int
+	Values           int
+	GeneDiversity    float64
+	AlleleVariance   float64
+	EffectiveAlleles float64
+}
+
+// WriteDiversity writes the diversity of each marker and a summary
+// for groups of persons. names contains the group names and statistics
+// the marker statistics for each group. Markers without values are
+// omitted.
+//
+// If the filename ends with ".csv" the file is written in CSV format,
+// where the summary of a group is written as marker "all". The
+// summary contains the number of markers in the column Markers.
+// Otherwise the file is written in JSON format.
+func WriteDiversity(filename string, names []string, statistics []*genetic.MarkerStatistics) error {
+	data := make([]diversityJSON, len(names))
+	for i, name := range names {
+		s := statistics[i]
+		data[i] = diversityJSON{Group: name, Summary: s.Summary(), Markers: make([]markerDiversityJSON, 0)}
+		for marker := range s.Markers {
+			occurrences := s.Markers[marker].ValuesOccurrences
+			if occurrences == nil {
+				continue
+			}
+			samples := 0
+			for _, count := range occurrences {
+				samples += count
+			}
+			data[i].Markers = append(data[i].Markers, markerDiversityJSON{
+				Marker:           genetic.YstrMarkerTable[marker].InternalName,
+				Samples:          samples,
+				Values:           len(occurrences),
+				GeneDiversity:    s.GeneDiversity(marker),
+				AlleleVariance:   s.AlleleVariance(marker),
+				EffectiveAlleles: s.EffectiveAlleles(marker),
+			})
+		}
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		text, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filename, text, os.ModePerm)
+	}
+
+	// Open file.
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	writer := csv.NewWriter(outfile)
+	writer.Write([]string{"Group", "Marker", "Samples", "Values", "Markers", "Haplotypes", "HaplotypeDiversity",
+		"GeneDiversity", "AlleleVariance", "EffectiveAlleles"})
+	for _, group := range data {
+		for _, m := range group.Markers {
+			writer.Write([]string{group.Group, m.Marker, strconv.Itoa(m.Samples), strconv.Itoa(m.Values), "", "", "",
+				format(m.GeneDiversity), format(m.AlleleVariance), format(m.EffectiveAlleles)})
+		}
+		summary := group.Summary
+		writer.Write([]string{group.Group, "all", strconv.Itoa(summary.NSamples), "", strconv.Itoa(summary.NMarkers),
+			strconv.Itoa(summary.NHaplotypes), format(summary.HaplotypeDiversity),
+			format(summary.MeanGeneDiversity), format(summary.MeanAlleleVariance), format(summary.MeanEffectiveAlleles)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
 // ReadMutationRates reads mutation rates from a file.
 // The mutation rates must be provided in JSON format.
 func ReadMutationRates(filename string) (genetic.YstrMarkers, error) {
@@ -609,7 +1743,7 @@ func ReadMutationRates(filename string) (genetic.YstrMarkers, error) {
 		case float64:
 			markerValue = v
 		default:
-			fmt.Printf("ReadMutationRates, unknown value: %v.\n", v)
+			return result, fmt.Errorf("invalid mutation rate for %s: %v", key, v)
 		}
 		// Fill result with values.
 		result[names[key]] = markerValue
@@ -638,11 +1772,12 @@ func WriteMutationRates(filename string, mutationRates genetic.YstrMarkers) erro
 	return nil
 }
 
-// stringToLabel transforms a string to a label.
+// StringToLabel transforms a string to a label.
 // A label is exactly 10 characters long
 // and contains only 8-bit characters.
 // All spaces are transformed to underscores.
-func stringToLabel(name string) string {
+// Labels are compatible with PHYLIP and the Newick tree format.
+func StringToLabel(name string) string {
 	replacements := map[rune]string{
 		' ': "_",
 		'Ä': "Ae",
@@ -688,3 +1823,259 @@ func stringToLabel(name string) string {
 	}
 	return newName
 }
+
+// haplogroupModelJSON is the file format of a haplogroup model.
+// Marker names are the internal names of YstrMarkerTable and
+// allele values are written as strings, because JSON supports
+// only strings as keys.
+type haplogroupModelJSON struct {
+	MinFrequency float64
+	Haplogroups  []haplogroupJSON
+}
+
+// haplogroupJSON contains the allele frequencies for a single
+// haplogroup in the file format of a haplogroup model.
+type haplogroupJSON struct {
+	Name        string
+	Prior       float64
+	Frequencies map[string]map[string]float64
+}
+
+// ReadHaplogroupModel reads a reference model for haplogroup
+// prediction from a file in JSON format.
+//
+// Example:
+//
+//	{"MinFrequency": 0.001,
+//	 "Haplogroups": [
+//	   {"Name": "R-U106", "Prior": 0.3,
+//	    "Frequencies": {"DYS393": {"13": 0.95, "14": 0.05}}}]}
+func ReadHaplogroupModel(filename string) (*genetic.HaplogroupModel, error) {
+	// Map marker names to indices.
+	var names = make(map[string]int)
+	for i, _ := range genetic.YstrMarkerTable {
+		names[genetic.YstrMarkerTable[i].InternalName] = i
+	}
+	// Open file.
+	infile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	// Read JSON from file.
+	var data haplogroupModelJSON
+	decoder := json.NewDecoder(infile)
+	err = decoder.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	// Convert names and values.
+	model := genetic.HaplogroupModel{MinFrequency: data.MinFrequency}
+	for _, h := range data.Haplogroups {
+		haplogroup := genetic.HaplogroupFrequencies{
+			Name:        h.Name,
+			Prior:       h.Prior,
+			Frequencies: make(map[int]map[float64]float64),
+		}
+		for name, alleles := range h.Frequencies {
+			index, exists := names[name]
+			if !exists {
+				return nil, errors.New(fmt.Sprintf("unknown marker %s in haplogroup %s", name, h.Name))
+			}
+			haplogroup.Frequencies[index] = make(map[float64]float64)
+			for allele, frequency := range alleles {
+				value, err := strconv.ParseFloat(allele, 64)
+				if err != nil {
+					return nil, err
+				}
+				haplogroup.Frequencies[index][value] = frequency
+			}
+		}
+		model.Haplogroups = append(model.Haplogroups, &haplogroup)
+	}
+	return &model, nil
+}
+
+// WriteHaplogroupModel writes a reference model for haplogroup
+// prediction to a file in JSON format.
+// The file format is described at ReadHaplogroupModel.
+func WriteHaplogroupModel(filename string, model *genetic.HaplogroupModel) error {
+	var data haplogroupModelJSON
+	data.MinFrequency = model.MinFrequency
+	for _, h := range model.Haplogroups {
+		frequencies := make(map[string]map[string]float64)
+		for index, alleles := range h.Frequencies {
+			name := genetic.YstrMarkerTable[index].InternalName
+			frequencies[name] = make(map[string]float64)
+			for value, frequency := range alleles {
+				frequencies[name][strconv.FormatFloat(value, 'f', -1, 64)] = frequency
+			}
+		}
+		data.Haplogroups = append(data.Haplogroups, haplogroupJSON{
+			Name:        h.Name,
+			Prior:       h.Prior,
+			Frequencies: frequencies,
+		})
+	}
+	// encoding/json sorts map keys, so the output is deterministic.
+	text, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, text, os.ModePerm)
+}
+
+// ReadNewickTree reads a phylogenetic tree in Newick format from a
+// file, for example the outtree file created by PHYLIP.
+// Only the first tree of the file is read.
+// Labels may be quoted by single quotes. Comments in square
+// brackets are ignored.
+func ReadNewickTree(filename string) (*genetic.Node, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNewick(string(data))
+}
+
+// ParseNewick parses a phylogenetic tree in Newick format.
+func ParseNewick(text string) (*genetic.Node, error) {
+	parser := newickParser{text: text}
+	root, err := parser.node()
+	if err != nil {
+		return nil, err
+	}
+	parser.skipSpace()
+	if parser.pos >= len(parser.text) || parser.text[parser.pos] != ';' {
+		return nil, errors.New(fmt.Sprintf("Newick tree: missing ';' at position %d", parser.pos))
+	}
+	return root, nil
+}
+
+// newickParser is a simple recursive descent parser for trees
+// in Newick format.
+type newickParser struct {
+	text string
+	pos  int
+}
+
+// skipSpace skips white space and comments.
+func (p *newickParser) skipSpace() {
+	for p.pos < len(p.text) {
+		switch p.text[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		case '[':
+			end := strings.IndexByte(p.text[p.pos:], ']')
+			if end < 0 {
+				p.pos = len(p.text)
+			} else {
+				p.pos += end + 1
+			}
+		default:
+			return
+		}
+	}
+}
+
+// node parses a node with its children, label and branch length.
+func (p *newickParser) node() (*genetic.Node, error) {
+	node := new(genetic.Node)
+	p.skipSpace()
+	if p.pos < len(p.text) && p.text[p.pos] == '(' {
+		p.pos++
+		for {
+			child, err := p.node()
+			if err != nil {
+				return nil, err
+			}
+			node.AddChild(child)
+			p.skipSpace()
+			if p.pos >= len(p.text) {
+				return nil, errors.New("Newick tree: unexpected end of tree")
+			}
+			if p.text[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			if p.text[p.pos] == ')' {
+				p.pos++
+				break
+			}
+			return nil, errors.New(fmt.Sprintf("Newick tree: unexpected character %q at position %d", p.text[p.pos], p.pos))
+		}
+	}
+	p.skipSpace()
+	node.Name = p.label()
+	p.skipSpace()
+	if p.pos < len(p.text) && p.text[p.pos] == ':' {
+		p.pos++
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.text) && strings.IndexByte("0123456789.-+eE", p.text[p.pos]) >= 0 {
+			p.pos++
+		}
+		length, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Newick tree: invalid branch length at position %d", start))
+		}
+		node.Length = length
+	}
+	return node, nil
+}
+
+// label parses an optional label. Underscores in unquoted labels
+// are kept, because Phylofriend uses them in labels.
+func (p *newickParser) label() string {
+	if p.pos < len(p.text) && p.text[p.pos] == '\'' {
+		// Quoted label, two single quotes represent one.
+		var buffer bytes.Buffer
+		p.pos++
+		for p.pos < len(p.text) {
+			if p.text[p.pos] == '\'' {
+				if p.pos+1 < len(p.text) && p.text[p.pos+1] == '\'' {
+					buffer.WriteByte('\'')
+					p.pos += 2
+					continue
+				}
+				p.pos++
+				break
+			}
+			buffer.WriteByte(p.text[p.pos])
+			p.pos++
+		}
+		return buffer.String()
+	}
+	start := p.pos
+	for p.pos < len(p.text) && strings.IndexByte("(),:;[ \t\n\r", p.text[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// MapLabels assigns persons to the leaves of a tree by comparing
+// the leaf names with the persons' labels. Leaf names are transformed
+// by the same rules as labels (see StringToLabel), so labels that
+// have been truncated or padded by PHYLIP are found.
+// The Y-STR values of each person are copied to its leaf.
+// MapLabels returns the names of all leaves without a person.
+func MapLabels(tree *genetic.Node, persons []*genetic.Person) (unmapped []string) {
+	labels := make(map[string]*genetic.Person)
+	for _, person := range persons {
+		labels[person.Label] = person
+	}
+	unmapped = make([]string, 0)
+	for _, leaf := range tree.Leaves() {
+		person, exists := labels[leaf.Name]
+		if !exists {
+			person, exists = labels[StringToLabel(strings.TrimSpace(leaf.Name))]
+		}
+		if exists {
+			leaf.Person = person
+			leaf.YstrMarkers = person.YstrMarkers
+		} else {
+			unmapped = append(unmapped, leaf.Name)
+		}
+	}
+	return unmapped
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yogischogi/phylofriend/genetic"
+	"github.com/yogischogi/phylofriend/genfiles"
+)
+
+// inputFlags contains the flags for reading persons and mutation rates
+// and for the calculation of genetic distances. They are shared by
+// all commands.
+type inputFlags struct {
+	config       *string
+	personsin    *string
+	informat     *string
+	labelcol     *int
+	groupcol     *int
+	mrin         *string
+	model        *string
+	microalleles *string
+	palindromic  *string
+	nmarkers     *int
+	impute       *string
+	neighbours   *int
+	reduce       *int
+	anonymize    *bool
+}
+
+// addInputFlags defines the input flags for a flag set.
+func addInputFlags(fs *flag.FlagSet) *inputFlags {
+	return &inputFlags{
+		config:       fs.String("config", "", "Filename of a project configuration file in JSON format."),
+		personsin:    fs.String("personsin", "", "Input filename (.txt or .csv) or directory, - for standard input."),
+		informat:     fs.String("informat", "", "Format of the persons input: csv or txt (default by file extension)."),
+		labelcol:     fs.Int("labelcol", 1, "Column number for labels in CSV file."),
+		groupcol:     fs.Int("groupcol", 0, "Column number for groups in CSV file."),
+		mrin:         fs.String("mrin", "", "Filename for the import of mutation rates."),
+		model:        fs.String("model", "hybrid", "Mutation model: hybrid or infinite."),
+		microalleles: fs.String("microalleles", "fractional", "Scoring of microalleles: fractional, step or infinite."),
+		palindromic:  fs.String("palindromic", "ftdna", "Scoring of palindromic markers: ftdna, genebase, sorted or ignore."),
+		nmarkers:     fs.Int("nmarkers", 0, "Uses only the given number of markers for calculations."),
+		impute:       fs.String("impute", "", "Imputes missing markers for -nmarkers: modal or neighbours."),
+		neighbours:   fs.Int("neighbours", 5, "Number of nearest persons used for imputation."),
+		reduce:       fs.Int("reduce", 1, "Reduces the number of persons (for big trees)."),
+		anonymize:    fs.Bool("anonymize", false, "Anonymizes persons' private data."),
+	}
+}
+
+// parse parses the arguments of a flag set. If a configuration file
+// is given by -config, all flags that are not set by the arguments
+// are read from the file and the effective configuration is written
+// to the output directory, unless this would overwrite the
+// configuration file.
+// If an output is written to standard output, messages are printed
+// to standard error.
+func (in *inputFlags) parse(fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	if *in.config == "" {
+		return setMessages(fs)
+	}
+	unused, err := readConfig(*in.config, fs)
+	if err := setMessages(fs); err != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("reading config file %s, %v", *in.config, err)
+	}
+	if len(unused) > 0 {
+		fmt.Fprintf(messages, "Warning, options in config file not used: %s.\n", strings.Join(unused, ", "))
+	}
+	filename := filepath.Join(outputDir(fs), configFilename)
+	if isSameFile(filename, *in.config) {
+		fmt.Fprintf(messages, "Warning, effective configuration not written, because it would overwrite %s.\n", *in.config)
+		return nil
+	}
+	err = writeConfig(filename, fs)
+	if err != nil {
+		return fmt.Errorf("writing effective configuration, %v", err)
+	}
+	return nil
+}
+
+// standardStreams contains the flags that accept "-" for standard
+// input or standard output.
+var standardStreams = map[string]bool{
+	"personsin":   true,
+	"txtout":      true,
+	"htmlout":     true,
+	"phylipout":   true,
+	"groupmodals": true,
+	"out":         true,
+}
+
+// setMessages prints messages to standard error if an output flag
+// of fs is set to "-" for standard output. It returns an error if
+// "-" is given for a flag that does not support it.
+func setMessages(fs *flag.FlagSet) error {
+	unsupported := make([]string, 0)
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case f.Value.String() != "-":
+		case !standardStreams[f.Name]:
+			unsupported = append(unsupported, "-"+f.Name)
+		case f.Name != "personsin":
+			messages = os.Stderr
+		}
+	})
+	if len(unsupported) > 0 {
+		return fmt.Errorf("- is not supported by %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// distanceModel returns the distance model given by the flags.
+func (in *inputFlags) distanceModel() (genetic.DistanceModel, error) {
+	var (
+		distanceModel genetic.DistanceModel
+		err           error
+	)
+	switch *in.model {
+	case "infinite":
+		distanceModel.InfiniteAlleles = true
+	case "hybrid":
+		distanceModel.InfiniteAlleles = false
+	default:
+		return distanceModel, errors.New("unknown mutation model: " + *in.model)
+	}
+	distanceModel.Microalleles, err = genetic.NewMicroallelePolicy(*in.microalleles)
+	if err != nil {
+		return distanceModel, err
+	}
+	distanceModel.Palindromic, err = genetic.NewPalindromicMethod(*in.palindromic)
+	return distanceModel, err
+}
+
+// mutationRates reads the mutation rates from a file or
+// returns the default mutation rates.
+func (in *inputFlags) mutationRates() (genetic.YstrMarkers, error) {
+	if *in.mrin != "" {
+		mutationRates, err := genfiles.ReadMutationRates(*in.mrin)
+		if err != nil {
+			return mutationRates, fmt.Errorf("reading mutation rates %v", err)
+		}
+		return mutationRates, nil
+	}
+	return genetic.DefaultMutationRates(), nil
+}
+
+// nMarkers returns the number of markers given by -nmarkers or
+// MaxMarkers if it is not set.
+func (in *inputFlags) nMarkers() int {
+	if *in.nmarkers > 0 {
+		return *in.nmarkers
+	}
+	return genetic.MaxMarkers
+}
+
+// readPersons reads persons from all files given by -personsin.
+// Afterwards the persons are reduced to -nmarkers markers or the
+// missing values are imputed, the number of persons is reduced by
+// -reduce and the persons are anonymized if requested.
+// mutationRates and distanceModel are used for imputation.
+func (in *inputFlags) readPersons(mutationRates genetic.YstrMarkers, distanceModel genetic.DistanceModel) ([]*genetic.Person, error) {
+	var (
+		persons []*genetic.Person
+		err     error
+	)
+	if *in.personsin == "" {
+		return nil, errors.New("no input file (-personsin)")
+	}
+	switch *in.informat {
+	case "", "csv", "txt":
+	default:
+		return nil, errors.New("unknown input format: " + *in.informat)
+	}
+	filenames := strings.Split(*in.personsin, ",")
+	for _, filename := range filenames {
+		var (
+			pers     []*genetic.Person
+			fileInfo os.FileInfo
+		)
+		if filename != "-" {
+			fileInfo, err = os.Stat(filename)
+			if err != nil {
+				return nil, fmt.Errorf("something is wrong with personsin, %v", err)
+			}
+		}
+		switch {
+		case filename == "-" && *in.informat == "":
+			return nil, errors.New("reading persons from standard input needs -informat")
+		case filename == "-" && in.isCSV(filename):
+			pers, err = genfiles.ReadPersonsFromCSVReader(os.Stdin, *in.labelcol-1, *in.groupcol-1)
+		case filename == "-":
+			pers, err = genfiles.ReadPersonsFromTXTReader(os.Stdin)
+		case fileInfo.IsDir():
+			pers, err = genfiles.ReadPersonsFromDir(filename, messages)
+		case in.isCSV(filename):
+			pers, err = genfiles.ReadPersonsFromCSVWithGroups(filename, *in.labelcol-1, *in.groupcol-1)
+		default:
+			pers, err = genfiles.ReadPersonsFromTXT(filename)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading persons data %v", err)
+		}
+		persons = append(persons, pers...)
+	}
+
+	// Include only persons who have tested at least for the given number of markers
+	// or impute the missing values.
+	if *in.nmarkers > 0 && *in.impute != "" {
+		imputation := genetic.Imputation{
+			NNeighbours:   *in.neighbours,
+			MutationRates: mutationRates,
+			Model:         distanceModel,
+		}
+		imputation.Method, err = genetic.NewImputationMethod(*in.impute)
+		if err != nil {
+			return nil, err
+		}
+		persons, err = genetic.ImputeToMarkerSet(persons, *in.nmarkers, imputation)
+		if err != nil {
+			return nil, fmt.Errorf("imputing persons for the specified number of markers, %v", err)
+		}
+		for _, person := range persons {
+			if len(person.Imputed) > 0 {
+				fmt.Fprintf(messages, "Warning, %d imputed marker values for %s.\n", len(person.Imputed), person.Label)
+			}
+		}
+	} else if *in.nmarkers > 0 {
+		persons, err = genetic.ReduceToMarkerSet(persons, *in.nmarkers)
+		if err != nil {
+			return nil, fmt.Errorf("reducing persons for the specified number of markers, %v", err)
+		}
+	}
+
+	// Reduce amount of data.
+	// This is for cases in which the tree gets too large.
+	if *in.reduce > 1 {
+		persons, err = genetic.Reduce(persons, *in.reduce)
+		if err != nil {
+			return nil, fmt.Errorf("reducing amount of persons, %v", err)
+		}
+	}
+
+	// Anonymize persons data.
+	if *in.anonymize == true {
+		persons = genetic.Anonymize(persons)
+	}
+	return persons, nil
+}
+
+// isCSV returns true if persons are read from filename in CSV format.
+// The format is given by -informat or by the file extension.
+func (in *inputFlags) isCSV(filename string) bool {
+	if *in.informat != "" {
+		return *in.informat == "csv"
+	}
+	return strings.HasSuffix(strings.ToLower(filename), ".csv")
+}
@@ -5,185 +5,229 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/yogischogi/phylofriend/genetic"
 	"github.com/yogischogi/phylofriend/genfiles"
 )
 
-func main() {
+// runFlags runs the program in the original form, where all
+// operations are controlled by flags and performed in a fixed order.
+// It is used if no command is given.
+func runFlags() {
 	// Command line flags.
+	in := addInputFlags(flag.CommandLine)
 	var (
-		personsin  = flag.String("personsin", "", "Input filename (.txt or .csv) or directory.")
-		labelcol   = flag.Int("labelcol", 1, "Column number for labels in CSV file.")
-		mrin       = flag.String("mrin", "", "Filename for the import of mutation rates.")
-		phylipout  = flag.String("phylipout", "", "Output filename for PHYLIP distance matrix.")
-		txtout     = flag.String("txtout", "", "Output filename for persons in text format.")
-		htmlout    = flag.String("htmlout", "", "Output filename for persons in HTML format.")
-		nmarkers   = flag.Int("nmarkers", 0, "Uses only the given number of markers for calculations.")
-		mrout      = flag.String("mrout", "", "Filename for the export of mutation rates.")
-		anonymize  = flag.Bool("anonymize", false, "Anonymizes persons' private data.")
-		cal        = flag.Float64("cal", 1, "Calibration factor for PHYLIP output.")
-		gentime    = flag.Float64("gentime", 1, "Generation time in years.")
-		modal      = flag.Bool("modal", false, "Creates modal haplotype.")
-		reduce     = flag.Int("reduce", 1, "Reduces the number of persons (for big trees).")
-		statistics = flag.Bool("statistics", false, "Prints marker statistics.")
-		model      = flag.String("model", "hybrid", "Mutation model: hybrid or infinite.")
+		phylipout    = flag.String("phylipout", "", "Output filename for PHYLIP distance matrix.")
+		nexusout     = flag.String("nexusout", "", "Output filename for NEXUS distance matrix.")
+		txtout       = flag.String("txtout", "", "Output filename for persons in text format.")
+		htmlout      = flag.String("htmlout", "", "Output filename for persons in HTML format.")
+		mrout        = flag.String("mrout", "", "Filename for the export of mutation rates.")
+		cal          = flag.Float64("cal", 1, "Calibration factor for PHYLIP output.")
+		gentime      = flag.Float64("gentime", 1, "Generation time in years.")
+		modal        = flag.Bool("modal", false, "Creates modal haplotype.")
+		statistics   = flag.Bool("statistics", false, "Prints marker statistics.")
+		compare      = flag.String("compare", "", "Compares two persons marker by marker, for example A,B.")
+		comparedout  = flag.String("comparedout", "", "Output filename for the number of compared markers per pair.")
+		minoverlap   = flag.Int("minoverlap", 0, "Minimum number of compared markers per pair.")
+		cluster      = flag.String("cluster", "", "Detects clusters of persons: hierarchical or density.")
+		cutoff       = flag.Float64("cutoff", 1, "Maximum distance within clusters.")
+		minpoints    = flag.Int("minpoints", 3, "Minimum number of neighbours for density clustering.")
+		clusterout   = flag.String("clusterout", "", "Output filename for persons with cluster names in CSV format.")
+		signatures   = flag.Bool("signatures", false, "Prints signature marker values for each group or cluster.")
+		signaturemin = flag.Float64("signaturemin", 0.9, "Minimum frequency of a signature value inside a group.")
+		signaturemax = flag.Float64("signaturemax", 0.1, "Maximum frequency of a signature value outside a group.")
+		hgmodel      = flag.String("hgmodel", "", "Filename of the reference model for haplogroup prediction.")
+		predict      = flag.Int("predict", 0, "Prints the given number of most likely haplogroups for each person.")
+		train        = flag.String("train", "", "Output filename for a haplogroup model trained with the groups of persons.")
+		smoothing    = flag.Float64("smoothing", 1, "Smoothing of allele counts for haplogroup models.")
+		folds        = flag.Int("folds", 0, "Number of folds for the cross validation of haplogroup models.")
+		outliers     = flag.Float64("outliers", 0, "Prints group members whose distance exceeds the group's mean by the given number of standard deviations.")
+		groupmodals  = flag.String("groupmodals", "", "Output filename (.txt or .csv) for the modal haplotypes of all groups.")
+		treein       = flag.String("treein", "", "Input filename for a tree in Newick format.")
+		ancestors    = flag.Bool("ancestors", false, "Reconstructs ancestral haplotypes and prints the mutations on each branch of a tree.")
+		rdfout       = flag.String("rdfout", "", "Output filename for persons in RDF format for Network.")
+		popartout    = flag.String("popartout", "", "Output filename for persons in NEXUS format for PopART.")
+		traits       = flag.String("traits", "group", "Traits for PopART output: group, origin or none.")
+		network      = flag.String("network", "", "Calculates a haplotype network: mj (median-joining) or msn (minimum spanning).")
+		networkout   = flag.String("networkout", "", "Output filename (.json or .graphml) for the haplotype network.")
+		networksvg   = flag.String("networksvg", "", "Output filename for an SVG image of the haplotype network.")
+		arpout       = flag.String("arpout", "", "Output filename for persons in Arlequin project format.")
+		genalexout   = flag.String("genalexout", "", "Output filename for persons in GenAlEx layout (CSV).")
+		populations  = flag.String("populations", "origin", "Grouping of persons into populations: origin or group.")
+		convert389   = flag.Bool("convert389", false, "Replaces DYS389ii by DYS389ii-i in population data.")
+		popstats     = flag.Bool("popstats", false, "Prints Fst, Rst and an AMOVA for the populations given by -populations.")
+		permutations = flag.Int("permutations", 1000, "Number of permutations for the p-values of population statistics.")
+		diversity    = flag.String("diversity", "", "Output filename (.csv or .json) for the diversity of markers and groups.")
+		statsout     = flag.String("statsout", "", "Output filename (.csv or .json) for marker statistics.")
+		minfreq      = flag.Float64("minfreq", 0, "Minimum share of persons who have tested for a marker in statistics.")
+		minvalues    = flag.Int("minvalues", 1, "Minimum number of different values of a marker in statistics.")
+		maxvalues    = flag.Int("maxvalues", 0, "Maximum number of different values of a marker in statistics (0 for no limit).")
+		countmrout   = flag.String("countmrout", "", "Output filename for counting mutation rates of the markers selected by -minfreq, -minvalues and -maxvalues.")
+		rankmarkers  = flag.Bool("rankmarkers", false, "Prints all markers ranked by information content.")
+		panel        = flag.Int("panel", 0, "Selects a panel of the given number of markers that best resolves the persons.")
+		panelby      = flag.String("panelby", "haplotypes", "Criterion for marker panels: haplotypes or tree.")
+		overlapmode  = flag.String("overlapmode", "flag", "Handling of pairs below minoverlap: flag or drop.")
 	)
-	flag.Parse()
+	exitOnError(in.parse(flag.CommandLine, os.Args[1:]), "parsing flags")
 
-	var (
-		persons       []*genetic.Person
-		mutationRates genetic.YstrMarkers
-		err           error
-	)
-
-	// Read mutation rates from file.
-	if *mrin != "" {
-		mutationRates, err = genfiles.ReadMutationRates(*mrin)
-		if err != nil {
-			fmt.Printf("Error reading mutation rates %v.\n", err)
-			os.Exit(1)
-		}
-	} else {
-		// Use default values.
-		mutationRates = genetic.DefaultMutationRates()
-	}
+	// Determine the distance model and read mutation rates
+	// from file or use default values.
+	distanceModel, err := in.distanceModel()
+	exitOnError(err, "in distance model")
+	mutationRates, err := in.mutationRates()
+	exitOnError(err, "reading mutation rates")
 
 	// Write mutation rates to file.
 	if *mrout != "" {
-		err = genfiles.WriteMutationRates(*mrout, mutationRates)
-		if err != nil {
-			fmt.Printf("Error writing mutation rates %v.\n", err)
-			os.Exit(1)
-		}
+		exitOnError(genfiles.WriteMutationRates(*mrout, mutationRates), "writing mutation rates")
 	}
 
-	// Read persons from files or exit if no file or wrong filename is provided.
-	if *personsin != "" {
-		filenames := strings.Split(*personsin, ",")
-		for _, filename := range filenames {
-			var pers []*genetic.Person
-			fileInfo, err := os.Stat(filename)
-			switch {
-			case err != nil:
-				fmt.Printf("Error, something is wrong with personsin, %v.\n", err)
-				os.Exit(1)
-			case fileInfo.IsDir():
-				pers, err = genfiles.ReadPersonsFromDir(filename)
-			case strings.HasSuffix(strings.ToLower(filename), ".csv"):
-				pers, err = genfiles.ReadPersonsFromCSV(filename, *labelcol-1)
-			default:
-				pers, err = genfiles.ReadPersonsFromTXT(filename)
-			}
-			if err != nil {
-				fmt.Printf("Error loading persons data %v.\n", err)
-				os.Exit(1)
-			}
-			persons = append(persons, pers...)
-		}
-	} else {
-		// Exit program because all following operations
-		// depend on persons data.
+	// Exit program if no file is provided because all
+	// following operations depend on persons data.
+	if *in.personsin == "" {
 		os.Exit(0)
 	}
 
-	// Include only persons who have tested at least for the given number of markers.
-	if *nmarkers > 0 {
-		persons, err = genetic.ReduceToMarkerSet(persons, *nmarkers)
-		if err != nil {
-			fmt.Printf("Error reducing persons for the specified number of markers, %v.\n", err)
-			os.Exit(1)
+	// Read persons from files, reduce them to the given number of
+	// markers, reduce the amount of data and anonymize them.
+	persons, err := in.readPersons(mutationRates, distanceModel)
+	exitOnError(err, "reading persons")
+	n := in.nMarkers()
+
+	// Print or write marker statistics.
+	if *statistics == true || *statsout != "" || *countmrout != "" {
+		stats := selectStatistics(persons, *minfreq, *minvalues, *maxvalues)
+		if *statistics == true {
+			fmt.Fprint(messages, stats.String())
 		}
-	}
-
-	// Reduce amount of data.
-	// This is for cases in which the tree gets too large.
-	if *reduce > 1 {
-		persons, err = genetic.Reduce(persons, *reduce)
-		if err != nil {
-			fmt.Printf("Error reducing amount of persons, %v.\n", err)
-			os.Exit(1)
+		if *statsout != "" {
+			exitOnError(genfiles.WriteStatistics(*statsout, stats), "writing statistics")
+		}
+		if *countmrout != "" {
+			exitOnError(genfiles.WriteCountingRates(*countmrout, stats), "writing counting mutation rates")
 		}
 	}
 
-	// Anonymize persons data.
-	if *anonymize == true {
-		persons = genetic.Anonymize(persons)
+	// Rank markers by information content and select a panel of markers.
+	if *rankmarkers == true {
+		fmt.Fprint(messages, genetic.MarkerRanksTable(genetic.RankMarkers(persons)))
 	}
-
-	// Print marker statistics.
-	if *statistics == true {
-		fmt.Print(genetic.NewStatistics(persons).String())
+	if *panel > 0 {
+		printPanel(persons, *panel, *panelby, mutationRates, distanceModel)
 	}
 
-	// Create modal haplotype.
-	if *modal == true {
-		modal := genetic.ModalHaplotype(persons)
-		persons = append([]*genetic.Person{modal}, persons...)
+	// Remove persons who share too few markers with others.
+	// Flagged pairs are handled together with the distance matrix.
+	var dm *genetic.DistanceMatrix
+	var compared *genetic.ComparedMatrix
+	if *minoverlap > 0 && *overlapmode != "flag" {
+		persons, dm, compared = distances(persons, *minoverlap, *overlapmode, mutationRates, distanceModel)
 	}
 
-	// Write persons data in text format.
-	if *txtout != "" {
-		if *nmarkers > 0 {
-			err = genfiles.WritePersonsAsTXT(*txtout, persons, *nmarkers)
-		} else {
-			err = genfiles.WritePersonsAsTXT(*txtout, persons, genetic.MaxMarkers)
-		}
-		if err != nil {
-			fmt.Printf("Error writing persons data to text file, %v.\n", err)
-			os.Exit(1)
+	// Detect clusters. They are used as groups by the following steps.
+	var clusters []*genetic.Cluster
+	if *cluster != "" {
+		clusters = detectClusters(persons, *cluster, *cutoff, *minpoints, mutationRates, distanceModel)
+		if *clusterout != "" {
+			writeClusters(*clusterout, persons, clusters, n)
 		}
 	}
-
-	// Write persons data in HTML format.
-	if *htmlout != "" {
-		if *nmarkers > 0 {
-			err = genfiles.WritePersonsAsHTML(*htmlout, persons, *nmarkers)
-		} else {
-			err = genfiles.WritePersonsAsHTML(*htmlout, persons, genetic.MaxMarkers)
+	if *signatures == true || *groupmodals != "" || *outliers > 0 || *diversity != "" {
+		groups := groupsOf(persons, clusters, "group", mutationRates, distanceModel)
+		if *signatures == true {
+			printSignatures(groups, *signaturemin, *signaturemax)
+		}
+		if *groupmodals != "" {
+			writeGroupModals(*groupmodals, groups, n, *gentime, *cal)
+		}
+		if *outliers > 0 {
+			printOutliers(groups, *outliers, mutationRates, distanceModel)
 		}
-		if err != nil {
-			fmt.Printf("Error writing persons data to HTML file, %v.\n", err)
-			os.Exit(1)
+		if *diversity != "" {
+			writeDiversity(*diversity, persons, groups)
 		}
 	}
+	if *popstats == true {
+		groups := groupsOf(persons, clusters, *populations, mutationRates, distanceModel)
+		printPopulationStatistics(groups, *permutations, distanceModel.Microalleles)
+	}
 
-	// Calculate a distance matrix if the modal value should be
-	// calculated or if the matrix should be written to a file.
-	var dm *genetic.DistanceMatrix
-	if *phylipout != "" || *modal == true {
-		switch *model {
-		case "infinite":
-			dm = genetic.NewDistanceMatrix(persons, mutationRates, genetic.DistanceInfiniteAlleles)
-		case "hybrid":
-			dm = genetic.NewDistanceMatrix(persons, mutationRates, genetic.DistanceHybrid)
-		default:
-			fmt.Printf("Error, unknown mutation model: %s.\n", *model)
-			os.Exit(1)
+	// Read a tree or calculate a UPGMA tree and reconstruct
+	// ancestral haplotypes.
+	var tree *genetic.Node
+	if *treein != "" {
+		tree = readTree(*treein, persons)
+	}
+	if *ancestors == true {
+		if tree == nil {
+			if len(persons) == 0 {
+				fmt.Fprintf(messages, "Error, no persons.\n")
+				os.Exit(1)
+			}
+			dm := genetic.NewDistanceMatrix(persons, mutationRates, distanceModel.Distance)
+			tree = genetic.NewUPGMATree(persons, dm)
 		}
-		dm = dm.Years(*gentime, *cal)
+		printAncestors(tree, distanceModel.Microalleles)
 	}
 
-	// Write distance matrix in phylip compatible format.
-	if *phylipout != "" {
-		err = genfiles.WriteDistanceMatrix(*phylipout, persons, dm)
-		if err != nil {
-			fmt.Printf("Error writing PHYLIP file %v.\n", err)
-		}
+	// Calculate a haplotype network.
+	if *network != "" {
+		buildNetwork(persons, *network, *networkout, *networksvg, distanceModel.Microalleles)
 	}
 
-	// Print average distance and standard deviation from modal haplotype.
+	// Train, cross validate and use haplogroup models.
+	if *train != "" {
+		trainHaplogroupModel(*train, persons, *smoothing)
+	}
+	if *folds > 1 {
+		fmt.Fprint(messages, genetic.CrossValidate(persons, *folds, *smoothing).String())
+	}
+	if *predict > 0 {
+		predictHaplogroups(*hgmodel, persons, *predict)
+	}
+
+	// Create modal haplotype. It is part of all following outputs.
 	if *modal == true {
-		// Calculate the average distance from the modal haplotype.
-		// The modal haplotype is the first in the distance matrix.
-		// The first entry is the distance to itself. So it has to be removed.
-		m, s, err := genetic.Average(dm.Values[0][1:dm.Size])
+		modal := genetic.ModalHaplotypeWith(persons, distanceModel.Microalleles)
+		persons = append([]*genetic.Person{modal}, persons...)
+		dm = nil
+	}
+
+	// Compare two persons marker by marker.
+	if *compare != "" {
+		comparePersons(persons, *compare, mutationRates, distanceModel)
+	}
 
-		if err != nil {
-			fmt.Printf("Error calculating average and standard deviation, %v.\n", err)
+	// Write persons data in other file formats.
+	conversion{
+		txtout:      *txtout,
+		htmlout:     *htmlout,
+		rdfout:      *rdfout,
+		popartout:   *popartout,
+		traits:      *traits,
+		arpout:      *arpout,
+		genalexout:  *genalexout,
+		populations: *populations,
+		clusters:    clusters,
+		convert389:  *convert389,
+	}.write(persons, n, mutationRates, distanceModel)
+
+	// Calculate a distance matrix if the modal value should be
+	// calculated, if the matrix should be written to a file or
+	// if pairs with too few compared markers should be flagged.
+	isFlagged := *minoverlap > 0 && *overlapmode == "flag"
+	if *phylipout != "" || *nexusout != "" || *comparedout != "" || *modal == true || isFlagged {
+		if dm == nil {
+			minFlagged := 0
+			if isFlagged {
+				minFlagged = *minoverlap
+			}
+			persons, dm, compared = distances(persons, minFlagged, "flag", mutationRates, distanceModel)
+		}
+		dm = dm.Years(*gentime, *cal)
+		writeDistances(persons, dm, compared, tree, *phylipout, *nexusout, *comparedout)
+		if *modal == true {
+			printModalDistance(dm)
 		}
-		fmt.Printf("Average distance from modal haplotype: %.2f \u00B1 %.2f\n", m, s)
-		fmt.Printf("No correction for Poisson distribution and back mutations.\n")
 	}
 }